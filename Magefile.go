@@ -105,3 +105,34 @@ func (Run) TriagerOpenAI(ctx context.Context, id string) error {
 
 	return sh.RunWith(env, command[0], command[1:]...)
 }
+
+func (Run) Eval(ctx context.Context, query string) error {
+	mg.Deps(func() error {
+		return buildCommand("triager-eval", runtime.GOOS+"_"+runtime.GOARCH)
+	})
+
+	command := []string{
+		"./bin/" + runtime.GOOS + "_" + runtime.GOARCH + "/triager-eval",
+		"-query=" + query,
+	}
+
+	return sh.RunV(command[0], command[1:]...)
+}
+
+// SyncLabels updates the category and type label files from the labels of repo
+func (Run) SyncLabels(ctx context.Context, repo string) error {
+	mg.Deps(func() error {
+		return buildCommand("triager-labels", runtime.GOOS+"_"+runtime.GOARCH)
+	})
+
+	command := "./bin/" + runtime.GOOS + "_" + runtime.GOARCH + "/triager-labels"
+
+	// the categories are the area and data source labels, and the few labels
+	// without a prefix the catalog also has
+	err := sh.RunV(command, "-repo="+repo, "-prefix=area/,datasource/,datagrid,team/grafana-aws-datasources", "-catalog=fixtures/categoryLabels.txt")
+	if err != nil {
+		return err
+	}
+
+	return sh.RunV(command, "-repo="+repo, "-prefix=type/", "-catalog=fixtures/typeLabels.txt")
+}
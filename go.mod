@@ -8,6 +8,7 @@ require (
 	github.com/mrz1836/go-sanitize v1.5.3
 	github.com/sashabaranov/go-openai v1.41.2
 	github.com/tiktoken-go/tokenizer v0.7.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require github.com/dlclark/regexp2 v1.11.5 // indirect
@@ -0,0 +1,188 @@
+package cassette
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	// ModeRecord sends the requests and saves the responses
+	ModeRecord = "record"
+	// ModeReplay serves the saved responses without touching the network
+	ModeReplay = "replay"
+)
+
+// Interaction is a recorded request and its response. It is stored as one
+// JSON file per request.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// Transport records or replays HTTP interactions in a cassette directory.
+// Requests are matched on method, URL and body; request headers (and so
+// credentials) are neither matched nor stored, and only the content type and
+// rate limit headers of the responses are stored.
+type Transport struct {
+	dir  string
+	mode string
+	base http.RoundTripper
+}
+
+func New(dir string, mode string) (*Transport, error) {
+	if mode != ModeRecord && mode != ModeReplay {
+		return nil, fmt.Errorf("unknown cassette mode %q", mode)
+	}
+
+	if mode == ModeRecord {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Transport{dir: dir, mode: mode, base: http.DefaultTransport}, nil
+}
+
+// Client returns an http.Client using the transport
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded := RecordedRequest{Method: req.Method, URL: req.URL.String()}
+
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		recorded.Body = string(body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	host := strings.ReplaceAll(req.URL.Host, ":", "_")
+	path := filepath.Join(t.dir, host, key(recorded)+".json")
+
+	if t.mode == ModeReplay {
+		return t.replay(req, recorded, path)
+	}
+
+	return t.record(req, recorded, path)
+}
+
+func (t *Transport) replay(req *http.Request, recorded RecordedRequest, path string) (*http.Response, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no recorded response for %s %s", recorded.Method, recorded.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var interaction Interaction
+	if err := json.Unmarshal(data, &interaction); err != nil {
+		return nil, fmt.Errorf("error decoding cassette %s: %w", path, err)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+		StatusCode:    interaction.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        interaction.Response.Header,
+		Body:          io.NopCloser(bytes.NewBufferString(interaction.Response.Body)),
+		ContentLength: int64(len(interaction.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+func (t *Transport) record(req *http.Request, recorded RecordedRequest, path string) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	interaction := Interaction{
+		Request: recorded,
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     recordedHeader(resp.Header),
+			Body:       string(body),
+		},
+	}
+
+	data, err := json.MarshalIndent(interaction, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// recordedHeaders are the response headers saved in the cassette, with the
+// headers starting with recordedHeaderPrefixes. The others, such as cookies,
+// organization and request IDs, are left out of the files meant to be
+// committed.
+var (
+	recordedHeaders        = []string{"Content-Type", "Retry-After", "Retry-After-Ms"}
+	recordedHeaderPrefixes = []string{"X-Ratelimit-", "Anthropic-Ratelimit-"}
+)
+
+// recordedHeader returns the headers of header that are saved
+func recordedHeader(header http.Header) http.Header {
+	recorded := http.Header{}
+	for name, values := range header {
+		name = http.CanonicalHeaderKey(name)
+		keep := slices.Contains(recordedHeaders, name) || slices.ContainsFunc(recordedHeaderPrefixes, func(prefix string) bool {
+			return strings.HasPrefix(name, prefix)
+		})
+		if keep {
+			recorded[name] = values
+		}
+	}
+	return recorded
+}
+
+// key identifies a request in the cassette
+func key(req RecordedRequest) string {
+	sum := sha256.Sum256([]byte(req.Method + " " + req.URL + "\n" + req.Body))
+	return hex.EncodeToString(sum[:12])
+}
@@ -0,0 +1,94 @@
+package cassette
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Ratelimit-Remaining-Requests", "99")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("Openai-Organization", "secret-org")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"echo":`+string(body)+`}`)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	post := func(client *http.Client, body string) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest("POST", server.URL+"/v1/chat/completions", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(data)
+	}
+
+	recorder, err := New(dir, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, recorded := post(recorder.Client(), `"one"`)
+
+	replayer, err := New(dir, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, replayed := post(replayer.Client(), `"one"`)
+
+	if requests != 1 {
+		t.Errorf("got %d requests to the server, want 1", requests)
+	}
+	if replayed != recorded || resp.StatusCode != http.StatusCreated || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("replayed %d %q, want 201 %q", resp.StatusCode, replayed, recorded)
+	}
+	if resp.Header.Get("X-Ratelimit-Remaining-Requests") != "99" || resp.Header.Get("Set-Cookie") != "" || resp.Header.Get("Openai-Organization") != "" {
+		t.Errorf("replayed headers %v, want only the content type and rate limit headers", resp.Header)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*", "*.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("got cassette files %v, %v, want 1", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Error("the cassette stores the credentials, cookies or organization")
+	}
+
+	// the body is part of the key
+	req, _ := http.NewRequest("POST", server.URL+"/v1/chat/completions", strings.NewReader(`"two"`))
+	if _, err := replayer.Client().Do(req); err == nil || !strings.Contains(err.Error(), "no recorded response") {
+		t.Errorf("got error %v, want no recorded response", err)
+	}
+}
+
+func TestNewUnknownMode(t *testing.T) {
+	if _, err := New(t.TempDir(), "rewind"); err == nil {
+		t.Error("New() accepted an unknown mode")
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/grafana/auto-triage/pkg/eval"
+	"github.com/grafana/auto-triage/pkg/github"
+	"github.com/grafana/auto-triage/pkg/llm"
+	"github.com/grafana/auto-triage/pkg/logme"
+	"github.com/grafana/auto-triage/pkg/triage"
+)
+
+// hiddenPrefixes are the label prefixes hidden from the issue, even the
+// labels missing from the catalogs, so they don't hint at the answer
+var hiddenPrefixes = []string{"area/", "type/"}
+
+var (
+	ghToken = os.Getenv("GH_TOKEN")
+	query   = flag.String(
+		"query",
+		"",
+		"GitHub search query of already triaged issues, e.g. \"repo:grafana/grafana is:issue is:closed label:type/bug\"",
+	)
+	limit = flag.Int(
+		"limit",
+		100,
+		"Maximum number of issues to evaluate",
+	)
+	githubURL = flag.String(
+		"githubURL",
+		github.DefaultBaseURL,
+		"GitHub REST API URL. Use https://<host>/api/v3 for GitHub Enterprise Server",
+	)
+	provider = flag.String(
+		"provider",
+		llm.ProviderOpenAI,
+		"LLM provider to use: "+strings.Join(llm.Providers, ", "),
+	)
+	baseURL = flag.String(
+		"baseURL",
+		"",
+		"Base URL of the provider API. Overrides the provider env vars",
+	)
+	categorizerModel = flag.String(
+		"categorizerModel",
+		"gpt-5.2",
+		"Model to use",
+	)
+	retries = flag.Int(
+		"retries",
+		5,
+		"Number of retries to use when categorizing an issue",
+	)
+	promptFile = flag.String(
+		"promptFile",
+		"fixtures/prompt.txt",
+		"Prompt to use for the categorizer",
+	)
+	labelsFile = flag.String(
+		"labelsFile",
+		"fixtures/categoryLabels.txt",
+		"Category labels file: one label per line, or a YAML or JSON label catalog",
+	)
+	typesFile = flag.String(
+		"typesFile",
+		"fixtures/typeLabels.txt",
+		"Type labels file: one label per line, or a YAML or JSON label catalog",
+	)
+	reportFile = flag.String(
+		"report",
+		"out/eval.json",
+		"File to write the JSON report to",
+	)
+	top = flag.Int(
+		"top",
+		10,
+		"Number of confusions to print in the summary",
+	)
+)
+
+func main() {
+	flag.Parse()
+
+	if *query == "" {
+		logme.FatalLn("Error validating flags: query is required")
+	}
+
+	categoryLabels, err := triage.ReadCatalog(*labelsFile)
+	if err != nil {
+		logme.FatalF("Error reading category labels: %v\n", err)
+	}
+
+	typeLabels, err := triage.ReadCatalog(*typesFile)
+	if err != nil {
+		logme.FatalF("Error reading type labels: %v\n", err)
+	}
+
+	prompt, err := os.ReadFile(*promptFile)
+	if err != nil {
+		logme.FatalF("Error reading prompt: %v\n", err)
+	}
+
+	cfg := llm.ConfigFromEnv(*provider)
+	if *baseURL != "" {
+		cfg.BaseURL = *baseURL
+	}
+
+	llmProvider, err := llm.NewProvider(cfg)
+	if err != nil {
+		logme.FatalF("Error setting up provider: %v\n", err)
+	}
+
+	retry := llm.DefaultRetryPolicy
+	retry.Attempts = *retries
+
+	categorizer := &triage.Categorizer{
+		Provider:       llmProvider,
+		Model:          *categorizerModel,
+		Prompt:         string(prompt),
+		CategoryLabels: categoryLabels,
+		TypeLabels:     typeLabels,
+		Retry:          retry,
+		Prices:         llm.DefaultPrices,
+	}
+
+	ctx := context.Background()
+	gh := github.NewClient(github.Config{
+		BaseURL: *githubURL,
+		Tokens:  github.StaticToken(ghToken),
+	})
+
+	issues, err := fetchIssues(ctx, gh, *query, *limit)
+	if err != nil {
+		logme.FatalF("Error fetching issues: %v\n", err)
+	}
+
+	logme.InfoF("Evaluating %d issues\n", len(issues))
+
+	// only the labels of the catalogs are scored, the model can't predict
+	// the others
+	evaluated := slices.Concat(categoryLabels, typeLabels)
+
+	usage := triage.Usage{}
+	samples := []eval.Sample{}
+	for _, issue := range issues {
+		sample := eval.Sample{
+			IssueID:  issue.Number,
+			Title:    issue.Title,
+			Expected: hideEvaluatedLabels(&issue, evaluated),
+		}
+
+		// issues without a single catalog label can't be scored
+		if len(sample.Expected) == 0 {
+			logme.DebugF("Issue %d has no evaluated labels. Skipping\n", issue.Number)
+			continue
+		}
+
+		category, err := categorizer.Categorize(ctx, &issue)
+		usage.Add(category.Usage)
+		if err != nil {
+			sample.Error = err.Error()
+		} else {
+			sample.Predicted = slices.DeleteFunc(slices.Concat(category.CategoryLabel, category.TypeLabel), func(label string) bool {
+				return !evaluated.Contains(label)
+			})
+		}
+
+		samples = append(samples, sample)
+	}
+
+	report := eval.Evaluate(samples)
+
+	reportJson, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		logme.FatalF("Error marshalling report: %v\n", err)
+	}
+
+	err = os.WriteFile(*reportFile, reportJson, 0644)
+	if err != nil {
+		logme.FatalF("Error writing report: %v\n", err)
+	}
+
+	printSummary(report, *top)
+
+	fmt.Printf(
+		"\nUsage: %d requests, %d prompt tokens, %d completion tokens, $%.4f\n",
+		usage.Requests,
+		usage.PromptTokens,
+		usage.CompletionTokens,
+		usage.CostUSD,
+	)
+}
+
+// fetchIssues pages through the search results until limit issues are found
+func fetchIssues(ctx context.Context, gh *github.Client, query string, limit int) ([]github.Issue, error) {
+	const perPage = 100
+
+	issues := []github.Issue{}
+	for page := 1; len(issues) < limit; page++ {
+		items, err := gh.GetIssuesByFilter(ctx, query, perPage, page)
+		if err != nil {
+			return nil, err
+		}
+
+		issues = append(issues, items...)
+
+		if len(items) < perPage {
+			break
+		}
+	}
+
+	if len(issues) > limit {
+		issues = issues[:limit]
+	}
+
+	return issues, nil
+}
+
+// hideEvaluatedLabels removes the labels of the catalog and the labels with
+// one of hiddenPrefixes from the issue, and returns the ones of the catalog
+func hideEvaluatedLabels(issue *github.Issue, catalog triage.Catalog) []string {
+	expected := []string{}
+	kept := []github.Label{}
+
+	for _, label := range issue.Labels {
+		inCatalog := catalog.Contains(label.Name)
+		hidden := inCatalog || slices.ContainsFunc(hiddenPrefixes, func(prefix string) bool {
+			return strings.HasPrefix(label.Name, prefix)
+		})
+
+		if inCatalog {
+			expected = append(expected, label.Name)
+		}
+		if !hidden {
+			kept = append(kept, label)
+		}
+	}
+
+	issue.Labels = kept
+
+	return expected
+}
+
+func printSummary(report eval.Report, top int) {
+	fmt.Printf("Issues: %d (%d failed)\n", report.Issues, report.Failed)
+	fmt.Printf("Exact match: %.3f\n", report.ExactMatch)
+	fmt.Printf(
+		"Micro precision: %.3f recall: %.3f f1: %.3f\n\n",
+		report.Micro.Precision,
+		report.Micro.Recall,
+		report.Micro.F1,
+	)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LABEL\tTP\tFP\tFN\tPRECISION\tRECALL\tF1")
+	for _, s := range report.Labels {
+		fmt.Fprintf(
+			w,
+			"%s\t%d\t%d\t%d\t%.3f\t%.3f\t%.3f\n",
+			s.Label,
+			s.TruePositives,
+			s.FalsePositives,
+			s.FalseNegatives,
+			s.Precision,
+			s.Recall,
+			s.F1,
+		)
+	}
+	w.Flush()
+
+	if len(report.Confusion) == 0 {
+		return
+	}
+
+	fmt.Printf("\nMost frequent confusions:\n")
+	for i, c := range report.Confusion {
+		if i == top {
+			break
+		}
+		fmt.Printf("  %s -> %s (%d)\n", c.Expected, c.Predicted, c.Count)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grafana/auto-triage/pkg/github"
+	"github.com/grafana/auto-triage/pkg/triage"
+)
+
+func TestHideEvaluatedLabels(t *testing.T) {
+	catalog := triage.Catalog{{Name: "area/alerting"}, {Name: "datasource/Prometheus"}, {Name: "type/bug"}}
+	issue := github.Issue{Labels: []github.Label{
+		{Name: "area/alerting"},
+		{Name: "area/not-in-catalog"},
+		{Name: "datasource/Prometheus"},
+		{Name: "type/bug"},
+		{Name: "priority/high"},
+	}}
+
+	expected := hideEvaluatedLabels(&issue, catalog)
+
+	if want := []string{"area/alerting", "datasource/Prometheus", "type/bug"}; !reflect.DeepEqual(expected, want) {
+		t.Errorf("got expected labels %v, want %v", expected, want)
+	}
+	if want := []github.Label{{Name: "priority/high"}}; !reflect.DeepEqual(issue.Labels, want) {
+		t.Errorf("got issue labels %v, want %v", issue.Labels, want)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/grafana/auto-triage/pkg/config"
+	"github.com/grafana/auto-triage/pkg/github"
+	"github.com/grafana/auto-triage/pkg/logme"
+	"github.com/grafana/auto-triage/pkg/triage"
+)
+
+// triageLabel is applied to every issue the triager labels
+const triageLabel = "automated-triage"
+
+var (
+	ghToken = os.Getenv("GH_TOKEN")
+	repo    = flag.String(
+		"repo",
+		"grafana/grafana",
+		"Github repo to read the labels from",
+	)
+	githubURL = flag.String(
+		"githubURL",
+		github.DefaultBaseURL,
+		"GitHub REST API URL. Use https://<host>/api/v3 for GitHub Enterprise Server",
+	)
+	prefix = flag.String(
+		"prefix",
+		"area/",
+		"Comma separated prefixes. Only the labels starting with one of them are kept in the catalog, e.g. area/,datasource/ or type/",
+	)
+	catalogFile = flag.String(
+		"catalog",
+		"fixtures/categoryLabels.txt",
+		"Label catalog to generate or update: one label per line, or a YAML or JSON label catalog",
+	)
+	configFile = flag.String(
+		"config",
+		"",
+		"Triage config file. Reports the labels it references that are missing from the repo",
+	)
+	dryRun = flag.Bool(
+		"dryRun",
+		false,
+		"Only report the changes, without writing the catalog",
+	)
+)
+
+// syncReport lists the changes made to the catalog
+type syncReport struct {
+	Repo    string   `json:"repo"`
+	Catalog string   `json:"catalog"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	// Kept is the number of labels that were already in the catalog
+	Kept int `json:"kept"`
+	// MissingFromRepo are labels referenced in the config that don't exist
+	// in the repo
+	MissingFromRepo []string `json:"missingFromRepo"`
+}
+
+func main() {
+	flag.Parse()
+
+	if ghToken == "" {
+		logme.FatalLn("Error validating flags: GH_TOKEN is required")
+	}
+	if *repo == "" || len(splitPrefixes(*prefix)) == 0 || *catalogFile == "" {
+		logme.FatalLn("Error validating flags: repo, prefix and catalog are required")
+	}
+
+	var cfg config.Config
+	if *configFile != "" {
+		var err error
+		cfg, err = config.Load(*configFile)
+		if err != nil {
+			logme.FatalF("Error loading config: %v\n", err)
+		}
+	}
+
+	current, err := triage.ReadCatalog(*catalogFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		logme.FatalF("Error reading label catalog: %v\n", err)
+	}
+
+	gh := github.NewClient(github.Config{
+		BaseURL: *githubURL,
+		Tokens:  github.StaticToken(ghToken),
+	})
+
+	repoLabels, err := gh.ListRepoLabels(context.Background(), *repo)
+	if err != nil {
+		logme.FatalF("Error listing repo labels: %v\n", err)
+	}
+	logme.InfoF("Found %d labels in %s\n", len(repoLabels), *repo)
+
+	catalog, report := syncCatalog(current, repoLabels, splitPrefixes(*prefix))
+	report.Repo = *repo
+	report.Catalog = *catalogFile
+	report.MissingFromRepo = missingLabels(repoLabels, append(cfg.ReferencedLabels(), triageLabel))
+
+	if !*dryRun {
+		err = triage.WriteCatalog(*catalogFile, catalog)
+		if err != nil {
+			logme.FatalF("Error writing label catalog: %v\n", err)
+		}
+		logme.InfoF("Wrote %d labels to %s\n", len(catalog), *catalogFile)
+	}
+
+	output, err := json.Marshal(report)
+	if err != nil {
+		logme.FatalF("Error marshaling report: %v\n", err)
+	}
+
+	fmt.Println(string(output))
+}
+
+// splitPrefixes returns the prefixes of the comma separated list
+func splitPrefixes(list string) []string {
+	prefixes := []string{}
+	for _, prefix := range strings.Split(list, ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// syncCatalog returns the catalog with the repo labels starting with one of
+// prefixes, sorted by name. The details of the labels already in the catalog
+// are kept, and new labels take the description from the repo.
+func syncCatalog(current triage.Catalog, repoLabels []github.Label, prefixes []string) (triage.Catalog, syncReport) {
+	report := syncReport{Added: []string{}, Removed: []string{}}
+
+	catalog := triage.Catalog{}
+	for _, repoLabel := range repoLabels {
+		matches := slices.ContainsFunc(prefixes, func(prefix string) bool {
+			return strings.HasPrefix(repoLabel.Name, prefix)
+		})
+		if !matches {
+			continue
+		}
+
+		i := slices.IndexFunc(current, func(label triage.Label) bool {
+			return label.Name == repoLabel.Name
+		})
+		if i >= 0 {
+			catalog = append(catalog, current[i])
+			report.Kept++
+			continue
+		}
+
+		catalog = append(catalog, triage.Label{Name: repoLabel.Name, Description: repoLabel.Description})
+		report.Added = append(report.Added, repoLabel.Name)
+	}
+
+	for _, label := range current {
+		if !catalog.Contains(label.Name) {
+			report.Removed = append(report.Removed, label.Name)
+		}
+	}
+
+	slices.SortFunc(catalog, func(a, b triage.Label) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	slices.Sort(report.Added)
+	slices.Sort(report.Removed)
+
+	return catalog, report
+}
+
+// missingLabels returns the labels that are not in the repo
+func missingLabels(repoLabels []github.Label, labels []string) []string {
+	missing := []string{}
+	for _, label := range labels {
+		exists := slices.ContainsFunc(repoLabels, func(repoLabel github.Label) bool {
+			return repoLabel.Name == label
+		})
+		if !exists {
+			missing = append(missing, label)
+		}
+	}
+	return missing
+}
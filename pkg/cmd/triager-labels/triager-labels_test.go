@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grafana/auto-triage/pkg/github"
+	"github.com/grafana/auto-triage/pkg/triage"
+)
+
+func TestSyncCatalog(t *testing.T) {
+	current := triage.Catalog{
+		{Name: "area/alerting", Description: "Grafana Alerting", Synonyms: []string{"alerts"}},
+		{Name: "datasource/Prometheus"},
+		{Name: "area/legacy"},
+	}
+	repoLabels := []github.Label{
+		{Name: "area/alerting", Description: "Alerting"},
+		{Name: "area/explore", Description: "Explore"},
+		{Name: "datasource/Prometheus"},
+		{Name: "datagrid", Description: "Data grid panel"},
+		{Name: "type/bug"},
+	}
+
+	catalog, report := syncCatalog(current, repoLabels, splitPrefixes("area/, datasource/,datagrid"))
+
+	want := triage.Catalog{
+		{Name: "area/alerting", Description: "Grafana Alerting", Synonyms: []string{"alerts"}},
+		{Name: "area/explore", Description: "Explore"},
+		{Name: "datagrid", Description: "Data grid panel"},
+		{Name: "datasource/Prometheus"},
+	}
+	if !reflect.DeepEqual(catalog, want) {
+		t.Errorf("got catalog %+v, want %+v", catalog, want)
+	}
+
+	if !reflect.DeepEqual(report.Added, []string{"area/explore", "datagrid"}) || !reflect.DeepEqual(report.Removed, []string{"area/legacy"}) || report.Kept != 2 {
+		t.Errorf("got report %+v, want area/explore and datagrid added, area/legacy removed and 2 kept", report)
+	}
+}
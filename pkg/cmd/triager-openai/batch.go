@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/grafana/auto-triage/pkg/github"
+	"github.com/grafana/auto-triage/pkg/logme"
+	"github.com/grafana/auto-triage/pkg/triage"
+)
+
+const (
+	searchPerPage = 100
+	// the search API never returns more than 1000 results for a query
+	searchMaxResults = 1000
+)
+
+// BatchResult is one line of the batch report
+type BatchResult struct {
+	Repo     string                   `json:"repo"`
+	IssueID  int                      `json:"issueId"`
+	Title    string                   `json:"title"`
+	Category *triage.CategorizedIssue `json:"category,omitempty"`
+	Error    string                   `json:"error,omitempty"`
+	// Usage is also reported for failed issues
+	Usage triage.Usage `json:"usage"`
+}
+
+// BatchSummary totals the batch. It is written as the last line of the
+// report, under a "summary" key.
+type BatchSummary struct {
+	Issues      int                     `json:"issues"`
+	Failed      int                     `json:"failed"`
+	Usage       triage.Usage            `json:"usage"`
+	UsageByRepo map[string]triage.Usage `json:"usageByRepo"`
+}
+
+// triageBatch triages every issue matching query with -concurrency workers and
+// writes one BatchResult per issue to -report
+func (t *triager) triageBatch(ctx context.Context, query string) error {
+	var out io.Writer = os.Stdout
+	if *reportFile != "-" {
+		file, err := os.Create(*reportFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	issues, err := t.searchIssues(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	logme.InfoF("Found %d issues for query %q\n", len(issues), query)
+
+	var (
+		mu      sync.Mutex
+		summary = BatchSummary{Issues: len(issues), UsageByRepo: map[string]triage.Usage{}}
+		encoder = json.NewEncoder(out)
+		wg      sync.WaitGroup
+		jobs    = make(chan github.Issue)
+	)
+
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for issue := range jobs {
+				result := BatchResult{
+					Repo:    issue.Repo(),
+					IssueID: issue.Number,
+					Title:   issue.Title,
+				}
+
+				category, err := t.triageIssue(ctx, &issue)
+				if err != nil {
+					logme.ErrorF("Error triaging issue %d: %v\n", issue.Number, err)
+					result.Error = err.Error()
+				} else {
+					result.Category = &category
+				}
+				result.Usage = category.Usage
+
+				mu.Lock()
+				if err != nil {
+					summary.Failed++
+				}
+				summary.Usage.Add(category.Usage)
+				repoUsage := summary.UsageByRepo[result.Repo]
+				repoUsage.Add(category.Usage)
+				summary.UsageByRepo[result.Repo] = repoUsage
+				if err := encoder.Encode(result); err != nil {
+					logme.ErrorF("Error writing report: %v\n", err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, issue := range issues {
+		jobs <- issue
+	}
+	close(jobs)
+	wg.Wait()
+
+	logme.InfoF(
+		"Triaged %d issues, %d failed. %d tokens, $%.4f\n",
+		summary.Issues,
+		summary.Failed,
+		summary.Usage.PromptTokens+summary.Usage.CompletionTokens,
+		summary.Usage.CostUSD,
+	)
+
+	return encoder.Encode(map[string]BatchSummary{"summary": summary})
+}
+
+// searchIssues pages through all the results of query
+func (t *triager) searchIssues(ctx context.Context, query string) ([]github.Issue, error) {
+	issues := []github.Issue{}
+
+	for page := 1; page*searchPerPage <= searchMaxResults; page++ {
+		result, err := t.gh.SearchIssues(ctx, query, searchPerPage, page)
+		if err != nil {
+			return nil, err
+		}
+
+		if page == 1 && result.TotalCount > searchMaxResults {
+			logme.ErrorF("The query matches %d issues, only the first %d are triaged. Narrow it down, by creation date for example, to triage the others\n", result.TotalCount, searchMaxResults)
+		}
+
+		issues = append(issues, result.Items...)
+
+		if len(result.Items) < searchPerPage {
+			break
+		}
+	}
+
+	return issues, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/grafana/auto-triage/pkg/triage"
+)
+
+// commentMarker identifies the comment of the triager so it is updated instead
+// of posting a new one on every run
+const commentMarker = "<!-- grafana-auto-triage -->"
+
+// explanationComment summarizes the labels chosen for the issue and why
+func explanationComment(category triage.CategorizedIssue) string {
+	var b strings.Builder
+
+	b.WriteString("### Automated triage\n\n")
+	b.WriteString("This issue was labelled automatically.\n\n")
+
+	labels := append(append([]string{}, category.CategoryLabel...), category.TypeLabel...)
+	if len(labels) > 0 {
+		b.WriteString("| Label | Confidence |\n| --- | --- |\n")
+		for _, label := range labels {
+			fmt.Fprintf(&b, "| `%s` | %s |\n", label, confidenceText(category, label))
+		}
+		b.WriteString("\n")
+	}
+
+	if len(category.LowConfidenceLabels) > 0 {
+		fmt.Fprintf(
+			&b,
+			"These labels were considered but not applied because of low confidence: `%s`. A maintainer will review the triage.\n\n",
+			strings.Join(category.LowConfidenceLabels, "`, `"),
+		)
+	}
+
+	if category.Remarks != "" {
+		fmt.Fprintf(&b, "**Rationale:** %s\n\n", category.Remarks)
+	}
+
+	b.WriteString("If the labels are wrong, feel free to change them.")
+
+	return b.String()
+}
+
+func notCategorizableComment(category triage.CategorizedIssue) string {
+	return fmt.Sprintf(`Thanks for opening this issue! We could not triage it automatically because it seems to be missing some information:
+
+> %s
+
+Please edit the issue to add the missing details, such as what you expected to happen, what happened instead and the steps to reproduce it.`, category.Remarks)
+}
+
+// renderComment executes the comment template from the config with the
+// categorization result, or uses the default comment when there is none
+func renderComment(text string, category triage.CategorizedIssue, fallback func(triage.CategorizedIssue) string) (string, error) {
+	if text == "" {
+		return fallback(category), nil
+	}
+
+	tmpl, err := template.New("comment").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("error parsing comment template: %w", err)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, category); err != nil {
+		return "", fmt.Errorf("error rendering comment template: %w", err)
+	}
+
+	return b.String(), nil
+}
+
+func confidenceText(category triage.CategorizedIssue, label string) string {
+	confidence, ok := category.Confidence[label]
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", confidence*100)
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/grafana/auto-triage/pkg/github"
+	"github.com/grafana/auto-triage/pkg/llm"
+	"github.com/grafana/auto-triage/pkg/logme"
+	"github.com/grafana/auto-triage/pkg/queue"
+	"github.com/grafana/auto-triage/pkg/triage"
+)
+
+const (
+	// GitHub caps webhook payloads at 25MB
+	maxPayloadBytes = 25 << 20
+	// deliveryTTL is how long the done jobs are kept to ignore repeated
+	// deliveries. GitHub redelivers within minutes, or manually within days.
+	deliveryTTL = 72 * time.Hour
+	// pollInterval is how often idle workers look for jobs due for a retry
+	pollInterval = time.Second
+)
+
+// triagedActions are the actions of the issues event that trigger a triage
+var triagedActions = []string{"opened", "edited", "reopened", "labeled"}
+
+// issuesEvent is the payload of the issues webhook event
+type issuesEvent struct {
+	Action     string        `json:"action"`
+	Issue      github.Issue  `json:"issue"`
+	Label      *github.Label `json:"label"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Sender github.User `json:"sender"`
+}
+
+// webhookServer receives the GitHub issues events and triages the issues in
+// the background
+type webhookServer struct {
+	t      *triager
+	secret []byte
+	queue  *queue.Queue
+	// login is the login of the triager, whose own changes are ignored
+	login string
+	// notify wakes up an idle worker when a job is enqueued
+	notify chan struct{}
+
+	// outMu serializes the results written to stdout
+	outMu sync.Mutex
+}
+
+// serve listens on addr until SIGINT or SIGTERM, then waits for the issues
+// being triaged. Events are stored in the queue in queueDir before being
+// triaged, so they survive restarts, and failed triages are retried.
+func (t *triager) serve(ctx context.Context, addr string, secret string, queueDir string) error {
+	q, err := queue.Open(queueDir)
+	if err != nil {
+		return fmt.Errorf("error opening queue: %w", err)
+	}
+	q.Policy.Attempts = *maxAttempts
+
+	recovered, err := q.Recover()
+	if err != nil {
+		return fmt.Errorf("error recovering jobs: %w", err)
+	}
+	if recovered > 0 {
+		logme.InfoF("Recovered %d jobs interrupted by the last shutdown\n", recovered)
+	}
+
+	login, err := t.gh.Login(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting the GitHub login of the triager: %w", err)
+	}
+
+	s := &webhookServer{
+		t:      t,
+		secret: []byte(secret),
+		queue:  q,
+		login:  login,
+		notify: make(chan struct{}, 1),
+	}
+
+	stop, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx, stop)
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.purgeDone(stop)
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook", s.handleWebhook)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		logme.InfoF("Listening for webhooks on %s\n", addr)
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err = <-errs:
+		cancel()
+	case <-stop.Done():
+		logme.InfoF("Shutting down, waiting for the issues being triaged")
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancelShutdown()
+		err = server.Shutdown(shutdownCtx)
+	}
+
+	wg.Wait()
+
+	return err
+}
+
+// work triages the jobs of the queue until stop is done. The job being
+// triaged is finished with ctx, so stopping doesn't interrupt it.
+func (s *webhookServer) work(ctx context.Context, stop context.Context) {
+	for stop.Err() == nil {
+		job, ok, err := s.queue.Claim(time.Now())
+		if err != nil {
+			logme.ErrorF("Error claiming job: %v\n", err)
+		}
+		if err != nil || !ok {
+			select {
+			case <-stop.Done():
+			case <-s.notify:
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+
+		s.triage(ctx, job)
+	}
+}
+
+// purgeDone deletes the done jobs older than deliveryTTL every hour
+func (s *webhookServer) purgeDone(stop context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.queue.Purge(queue.StatusDone, time.Now().Add(-deliveryTTL))
+		if err != nil {
+			logme.ErrorF("Error purging done jobs: %v\n", err)
+		} else if purged > 0 {
+			logme.DebugF("Purged %d done jobs\n", purged)
+		}
+
+		select {
+		case <-stop.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *webhookServer) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadBytes))
+	if err != nil {
+		http.Error(w, "error reading body", http.StatusBadRequest)
+		return
+	}
+
+	if !validSignature(s.secret, body, r.Header.Get("X-Hub-Signature-256")) {
+		logme.ErrorF("Rejected webhook with an invalid signature\n")
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	event := r.Header.Get("X-GitHub-Event")
+	deliveryID := r.Header.Get("X-GitHub-Delivery")
+	if event == "ping" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if event != "issues" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var payload issuesEvent
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	if reason := skipReason(payload, s.login); reason != "" {
+		logme.DebugF("Skipping delivery %s: %s\n", deliveryID, reason)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// the delivery ID is the job ID, so repeated deliveries are ignored
+	job := queue.Job{
+		ID:      deliveryID,
+		Repo:    payload.Repository.FullName,
+		IssueID: payload.Issue.Number,
+	}
+	if job.ID == "" {
+		job.ID = fmt.Sprintf("%s#%d@%d", job.Repo, job.IssueID, time.Now().UnixNano())
+	}
+
+	added, err := s.queue.Enqueue(job)
+	if err != nil {
+		logme.ErrorF("Error queueing delivery %s: %v\n", deliveryID, err)
+		http.Error(w, "error queueing event", http.StatusInternalServerError)
+		return
+	}
+	if !added {
+		logme.InfoF("Skipping delivery %s: already received\n", deliveryID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	logme.InfoF("Queued %s#%d (%s, delivery %s)\n", job.Repo, job.IssueID, payload.Action, deliveryID)
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// skipReason returns why the event doesn't trigger a triage, or "" when it
+// does. login is the login of the triager.
+func skipReason(payload issuesEvent, login string) string {
+	if !slices.Contains(triagedActions, payload.Action) {
+		return "action " + payload.Action
+	}
+	if payload.Issue.State != "" && payload.Issue.State != "open" {
+		return "issue is " + payload.Issue.State
+	}
+	if payload.Repository.FullName == "" || payload.Issue.Number == 0 {
+		return "no repository or issue"
+	}
+	// the labels and edits of bots and of the triager itself, also when it
+	// uses a user token, would trigger it again. Issues opened by bots are
+	// triaged.
+	if payload.Sender.Type == "Bot" && (payload.Action == "labeled" || payload.Action == "edited") {
+		return payload.Action + " by bot " + payload.Sender.Login
+	}
+	if login != "" && strings.EqualFold(payload.Sender.Login, login) {
+		return "sent by the triager " + payload.Sender.Login
+	}
+	if payload.Action == "labeled" && payload.Label != nil && isTriagerLabel(payload.Label.Name) {
+		return "label " + payload.Label.Name + " is set by the triager"
+	}
+	return ""
+}
+
+// isTriagerLabel reports whether the label is one the triager applies: a
+// managed (review and not categorizable included) or route label
+func isTriagerLabel(label string) bool {
+	return isManagedLabel(label) || triageConfig.IsRouteLabel(label)
+}
+
+// validSignature checks the X-Hub-Signature-256 header, the HMAC SHA-256 of
+// the body with the webhook secret
+func validSignature(secret []byte, body []byte, header string) bool {
+	signature, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// triage triages the issue of the job, records the outcome in the queue and
+// writes the result to stdout as a BatchResult line. A triage that takes
+// longer than -jobTimeout fails and is retried.
+func (s *webhookServer) triage(ctx context.Context, job queue.Job) {
+	ctx, cancel := context.WithTimeout(ctx, *jobTimeout)
+	defer cancel()
+
+	result := BatchResult{Repo: job.Repo, IssueID: job.IssueID}
+
+	category, err := s.triageIssue(ctx, job, &result)
+	if err != nil {
+		result.Error = err.Error()
+		job, err = s.queue.Fail(job, err, retryable(err))
+		if err != nil {
+			logme.ErrorF("Error recording failed job %s: %v\n", job.ID, err)
+		}
+		if job.Status == queue.StatusDead {
+			logme.ErrorF("Error triaging %s#%d, giving up after %d attempts: %s\n", job.Repo, job.IssueID, job.Attempts, job.LastError)
+		} else {
+			logme.ErrorF("Error triaging %s#%d, retrying at %s: %s\n", job.Repo, job.IssueID, job.NextAttempt.Format(time.RFC3339), job.LastError)
+		}
+	} else {
+		result.Category = &category
+		if err := s.queue.Complete(job); err != nil {
+			logme.ErrorF("Error completing job %s: %v\n", job.ID, err)
+		}
+	}
+	result.Usage = category.Usage
+
+	output, err := json.Marshal(result)
+	if err != nil {
+		logme.ErrorF("Error marshalling result: %v\n", err)
+		return
+	}
+
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	os.Stdout.Write(append(output, '\n'))
+}
+
+// retryable reports whether triaging the issue again may succeed. Issues that
+// don't exist or that the token can't change, changes GitHub rejects, labels
+// missing from the repo with -strictLabels and requests the model provider
+// rejects fail the same way every time.
+func retryable(err error) bool {
+	return llm.Retryable(err) &&
+		!errors.Is(err, errUnknownLabels) &&
+		!errors.Is(err, github.ErrNotFound) &&
+		!errors.Is(err, github.ErrForbidden) &&
+		!errors.Is(err, github.ErrValidation)
+}
+
+// triageIssue fetches the current state of the issue, which may have changed
+// since the event was sent, and triages it
+func (s *webhookServer) triageIssue(ctx context.Context, job queue.Job, result *BatchResult) (triage.CategorizedIssue, error) {
+	issue, err := s.t.gh.FetchIssueDetails(ctx, job.IssueID, job.Repo)
+	if err != nil {
+		return triage.CategorizedIssue{}, err
+	}
+	if issue.Title == "" {
+		return triage.CategorizedIssue{}, errors.New("title is empty")
+	}
+	result.Title = issue.Title
+
+	return s.t.triageIssue(ctx, &issue)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+func TestValidSignature(t *testing.T) {
+	secret := []byte("webhook secret")
+	body := []byte(`{"action":"opened","issue":{"number":1}}`)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name   string
+		secret []byte
+		body   []byte
+		header string
+		want   bool
+	}{
+		{"valid", secret, body, "sha256=" + signature, true},
+		{"other secret", []byte("other"), body, "sha256=" + signature, false},
+		{"changed body", secret, []byte(`{"action":"opened","issue":{"number":2}}`), "sha256=" + signature, false},
+		{"no prefix", secret, body, signature, false},
+		{"sha1", secret, body, "sha1=" + signature, false},
+		{"not hex", secret, body, "sha256=zz", false},
+		{"empty", secret, body, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validSignature(tt.secret, tt.body, tt.header); got != tt.want {
+				t.Errorf("validSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipReason(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		skipped bool
+	}{
+		{"opened", `{"action":"opened","issue":{"number":1,"state":"open"},"repository":{"full_name":"grafana/grafana"},"sender":{"login":"octocat","type":"User"}}`, false},
+		{"labeled by a person", `{"action":"labeled","issue":{"number":1},"label":{"name":"needs-investigation"},"repository":{"full_name":"grafana/grafana"},"sender":{"login":"octocat","type":"User"}}`, false},
+		{"closed", `{"action":"closed","issue":{"number":1},"repository":{"full_name":"grafana/grafana"},"sender":{"login":"octocat","type":"User"}}`, true},
+		{"closed issue", `{"action":"reopened","issue":{"number":1,"state":"closed"},"repository":{"full_name":"grafana/grafana"},"sender":{"login":"octocat","type":"User"}}`, true},
+		{"no repository", `{"action":"opened","issue":{"number":1},"sender":{"login":"octocat","type":"User"}}`, true},
+		{"opened by bot", `{"action":"opened","issue":{"number":1},"repository":{"full_name":"grafana/grafana"},"sender":{"login":"dependabot[bot]","type":"Bot"}}`, false},
+		{"labeled by bot", `{"action":"labeled","issue":{"number":1},"label":{"name":"needs-investigation"},"repository":{"full_name":"grafana/grafana"},"sender":{"login":"other-app[bot]","type":"Bot"}}`, true},
+		{"edited by bot", `{"action":"edited","issue":{"number":1},"repository":{"full_name":"grafana/grafana"},"sender":{"login":"other-app[bot]","type":"Bot"}}`, true},
+		{"triager login", `{"action":"labeled","issue":{"number":1},"label":{"name":"needs-investigation"},"repository":{"full_name":"grafana/grafana"},"sender":{"login":"Triage-Bot","type":"User"}}`, true},
+		{"managed label", `{"action":"labeled","issue":{"number":1},"label":{"name":"area/alerting"},"repository":{"full_name":"grafana/grafana"},"sender":{"login":"octocat","type":"User"}}`, true},
+		{"review label", `{"action":"labeled","issue":{"number":1},"label":{"name":"needs-triage-review"},"repository":{"full_name":"grafana/grafana"},"sender":{"login":"octocat","type":"User"}}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload issuesEvent
+			if err := json.Unmarshal([]byte(tt.payload), &payload); err != nil {
+				t.Fatal(err)
+			}
+
+			reason := skipReason(payload, "triage-bot")
+			if (reason != "") != tt.skipped {
+				t.Errorf("skipReason() = %q, want skipped %v", reason, tt.skipped)
+			}
+		})
+	}
+}
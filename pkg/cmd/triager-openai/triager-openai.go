@@ -1,50 +1,137 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"net/http"
 	"os"
 	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/grafana/auto-triage/pkg/cassette"
+	"github.com/grafana/auto-triage/pkg/config"
 	"github.com/grafana/auto-triage/pkg/github"
+	"github.com/grafana/auto-triage/pkg/llm"
 	"github.com/grafana/auto-triage/pkg/logme"
-	"github.com/mrz1836/go-sanitize"
-	"github.com/sashabaranov/go-openai"
-	"github.com/sashabaranov/go-openai/jsonschema"
+	"github.com/grafana/auto-triage/pkg/triage"
 	"github.com/tiktoken-go/tokenizer"
 )
 
-type QualityVeredict struct {
-	IsCategorizable bool        `json:"isCategorizable"`
-	ID              interface{} `json:"id"`
-	Remarks         string      `json:"remarks"`
-}
-
-type CategorizedIssue struct {
-	ID              interface{} `json:"id"`
-	CategoryLabel   []string    `json:"categoryLabel"`
-	TypeLabel       []string    `json:"typeLabel"`
-	IsCategorizable bool        `json:"isCategorizable"`
-	Remarks         string      `json:"remarks"`
-}
-
 var (
-	openAiKey  = os.Getenv("OPENAI_API_KEY")
 	ghToken    = os.Getenv("GH_TOKEN")
-	issueId    = flag.Int("issueId", 0, "Github Issue ID (only the number)")
-	repo       = flag.String("repo", "grafana/grafana", "Github repo to push the issue to")
+	configFile = flag.String(
+		"config",
+		"",
+		"YAML or JSON config file with the triage policy. Flags set on the command line take precedence",
+	)
+	issueId = flag.Int("issueId", 0, "Github Issue ID (only the number)")
+	repo    = flag.String("repo", "grafana/grafana", "Github repo to push the issue to")
+	query   = flag.String(
+		"query",
+		"",
+		"GitHub search query to triage in batch, e.g. \"repo:grafana/grafana is:issue is:open no:label\"",
+	)
+	concurrency = flag.Int(
+		"concurrency",
+		4,
+		"Number of issues triaged in parallel in batch mode",
+	)
+	cassetteDir = flag.String(
+		"cassette",
+		"",
+		"Directory to record GitHub and LLM responses to, or to replay them from",
+	)
+	cassetteMode = flag.String(
+		"cassetteMode",
+		cassette.ModeReplay,
+		"Cassette mode: record or replay",
+	)
+	serveAddr = flag.String(
+		"serve",
+		"",
+		"Address to listen for GitHub issues webhooks on, e.g. :8080. The issues are triaged in the background with -concurrency workers",
+	)
+	webhookSecret = flag.String(
+		"webhookSecret",
+		os.Getenv("GITHUB_WEBHOOK_SECRET"),
+		"Secret of the GitHub webhook, used to verify the X-Hub-Signature-256 header. Defaults to GITHUB_WEBHOOK_SECRET",
+	)
+	queueDir = flag.String(
+		"queue",
+		"out/queue",
+		"Directory of the durable queue of webhook events. Inspect it with triager-queue",
+	)
+	maxAttempts = flag.Int(
+		"maxAttempts",
+		5,
+		"Number of attempts to triage a webhook event before it is moved to the dead jobs of the queue",
+	)
+	jobTimeout = flag.Duration(
+		"jobTimeout",
+		15*time.Minute,
+		"Timeout of the triage of a webhook event. Timed out events are retried like other failures",
+	)
+	maxRateLimitWait = flag.Duration(
+		"maxRateLimitWait",
+		github.DefaultMaxRateLimitWait,
+		"How long GitHub requests wait for a rate limit to reset before failing",
+	)
+	requestTimeout = flag.Duration(
+		"requestTimeout",
+		10*time.Minute,
+		"Timeout of every request to GitHub and the model provider. Must be longer than -maxRateLimitWait, as the waits for GitHub rate limits count",
+	)
+	reportFile = flag.String(
+		"report",
+		"-",
+		"File to write the batch JSON Lines report to. - for stdout",
+	)
+	githubURL = flag.String(
+		"githubURL",
+		envOrDefault("GITHUB_API_URL", github.DefaultBaseURL),
+		"GitHub REST API URL. Use https://<host>/api/v3 for GitHub Enterprise Server",
+	)
 	promptFile = flag.String(
 		"promptFile",
 		"fixtures/prompt.txt",
 		"Prompt to use for the categorizer",
 	)
+	appId = flag.Int64(
+		"appId",
+		envInt64("GH_APP_ID"),
+		"GitHub App ID. When set the triager authenticates as the app instead of using GH_TOKEN",
+	)
+	appPrivateKey = flag.String(
+		"appPrivateKey",
+		os.Getenv("GH_APP_PRIVATE_KEY_PATH"),
+		"Path to the GitHub App private key (PEM)",
+	)
+	appInstallationId = flag.Int64(
+		"appInstallationId",
+		envInt64("GH_APP_INSTALLATION_ID"),
+		"GitHub App installation ID. Looked up from -repo when not set",
+	)
+	provider = flag.String(
+		"provider",
+		llm.ProviderOpenAI,
+		"LLM provider to use: "+strings.Join(llm.Providers, ", "),
+	)
+	baseURL = flag.String(
+		"baseURL",
+		"",
+		"Base URL of the provider API. Overrides the provider env vars",
+	)
+	organization = flag.String(
+		"organization",
+		"",
+		"OpenAI organization ID",
+	)
 	categorizerModel = flag.String(
 		"categorizerModel",
 		"gpt-5.2", // regular model from openai
@@ -55,44 +142,256 @@ var (
 		false,
 		"Add labels to the issue in the repo via the GitHub API",
 	)
+	validateLabels = flag.Bool(
+		"validateLabels",
+		true,
+		"Skip the labels that don't exist in the repo instead of letting GitHub create them",
+	)
+	dryRun = flag.Bool(
+		"dryRun",
+		false,
+		"Print the changes the triage would make to the issue, with the labels even without -addLabels, and make none",
+	)
+	applyPlanFile = flag.String(
+		"applyPlan",
+		"",
+		"Apply the plans of a file, such as the plan of a dry run, without categorizing again",
+	)
+	retriage = flag.Bool(
+		"retriage",
+		false,
+		"Remove the managed labels of the issue that are no longer predicted, and only add the missing labels",
+	)
+	managedLabels = flag.String(
+		"managedLabels",
+		"area/*,type/*,automated-triage",
+		"Comma separated label patterns owned by the triager, in addition to -reviewLabel and -notCategorizableLabel. A pattern ending in /* also matches nested labels",
+	)
+	strictLabels = flag.Bool(
+		"strictLabels",
+		false,
+		"Fail instead of skipping the labels that don't exist in the repo",
+	)
 	retries = flag.Int(
 		"retries",
 		5,
 		"Number of retries to use when categorizing an issue",
 	)
+	maxRetryDelay = flag.Duration(
+		"maxRetryDelay",
+		llm.DefaultRetryPolicy.MaxDelay,
+		"Longest wait between attempts to categorize an issue. The wait doubles from 1s after each failed attempt, or is the one asked by the provider rate limits",
+	)
+	discussionTokens = flag.Int(
+		"discussionTokens",
+		0,
+		"Token budget for the digest of the issue comments and timeline sent to the model. 0 to send only the title and description",
+	)
+	encoding = flag.String(
+		"tokenizer",
+		"",
+		"Tokenizer encoding used to count tokens (cl100k_base, o200k_base). Defaults to the encoding of the model",
+	)
+	maxInputTokens = flag.Int(
+		"maxInputTokens",
+		0,
+		"Maximum tokens of the prompt sent to the model. Long issue bodies are truncated to fit. 0 for no limit",
+	)
+	confidenceThreshold = flag.Float64(
+		"confidenceThreshold",
+		0,
+		"Minimum confidence (0-1) for a predicted label to be applied",
+	)
+	reviewLabel = flag.String(
+		"reviewLabel",
+		"needs-triage-review",
+		"Label applied instead of the low confidence labels",
+	)
+	comment = flag.Bool(
+		"comment",
+		false,
+		"Post a comment on the issue explaining the applied labels, with -addLabels. Updated in place on later runs",
+	)
+	notCategorizableLabel = flag.String(
+		"notCategorizableLabel",
+		"",
+		"Label applied to issues the model can't categorize, e.g. needs-more-info",
+	)
+	commentNotCategorizable = flag.Bool(
+		"commentNotCategorizable",
+		false,
+		"Post a comment explaining what is missing on issues the model can't categorize",
+	)
+	pricesFile = flag.String(
+		"pricesFile",
+		"",
+		"JSON file with the price per million tokens of each model, merged over the built-in prices",
+	)
 	labelsFile = flag.String(
 		"labelsFile",
 		"fixtures/categoryLabels.txt",
-		"Labels file. One label per line",
+		"Category labels file: one label per line, or a YAML or JSON label catalog",
 	)
 	typesFile = flag.String(
 		"typesFile",
 		"fixtures/typeLabels.txt",
-		"Types file. One label per line",
+		"Type labels file: one label per line, or a YAML or JSON label catalog",
 	)
 )
 
+// extraHeaders holds the -header flags sent with every provider request
+var extraHeaders = headerFlags{}
+
+// headerFlags collects repeated "Name: value" flags
+type headerFlags http.Header
+
+func (h headerFlags) String() string {
+	return fmt.Sprint(http.Header(h))
+}
+
+func (h headerFlags) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("header must be in the form \"Name: value\"")
+	}
+	http.Header(h).Add(strings.TrimSpace(name), strings.TrimSpace(val))
+	return nil
+}
+
+// triageConfig is the config file, empty when -config is not set
+var triageConfig config.Config
+
 func main() {
 	var err error
 
+	flag.Var(extraHeaders, "header", "Extra header to send to the provider API in the form \"Name: value\". Can be repeated")
 	flag.Parse()
 
+	err = loadConfig()
+	if err != nil {
+		logme.FatalF("Error loading config: %v\n", err)
+	}
+
+	if *applyPlanFile != "" {
+		err = validateGithubAuth(false)
+		if err != nil {
+			logme.FatalF("Error validating flags: %v\n", err)
+		}
+
+		t := &triager{
+			gh: github.NewClient(github.Config{
+				BaseURL:          *githubURL,
+				Tokens:           newTokenSource(),
+				MaxRateLimitWait: *maxRateLimitWait,
+			}),
+		}
+		err = t.applyPlanFile(context.Background(), *applyPlanFile)
+		if err != nil {
+			logme.FatalF("Error applying plan: %v\n", err)
+		}
+		return
+	}
+
 	err = validateFlags()
 	if err != nil {
 		logme.FatalF("Error validating flags: %v\n", err)
 	}
 
-	categoryLabels, err := readFileLines(*labelsFile)
+	categoryLabels, err := triage.ReadCatalog(*labelsFile)
 	if err != nil {
-		logme.FatalF("Error reading categoryLabels.txt: %v\n", err)
+		logme.FatalF("Error reading category labels: %v\n", err)
+	}
+
+	typeLabels, err := triage.ReadCatalog(*typesFile)
+	if err != nil {
+		logme.FatalF("Error reading type labels: %v\n", err)
+	}
+
+	excluded := func(label triage.Label) bool {
+		return triageConfig.IsExcluded(label.Name)
 	}
+	categoryLabels = slices.DeleteFunc(categoryLabels, excluded)
+	typeLabels = slices.DeleteFunc(typeLabels, excluded)
 
-	typeLabels, err := readFileLines(*typesFile)
+	prompt, err := os.ReadFile(*promptFile)
 	if err != nil {
-		logme.FatalF("Error reading typeLabels.txt: %v\n", err)
+		logme.FatalF("Error reading prompt: %v\n", err)
+	}
+
+	prices := llm.DefaultPrices
+	if *pricesFile != "" {
+		prices, err = llm.LoadPrices(*pricesFile)
+		if err != nil {
+			logme.FatalF("Error reading prices: %v\n", err)
+		}
+	}
+
+	// both clients share the cassette when recording or replaying
+	httpClient := &http.Client{Timeout: *requestTimeout}
+	if *cassetteDir != "" {
+		transport, err := cassette.New(*cassetteDir, *cassetteMode)
+		if err != nil {
+			logme.FatalF("Error opening cassette: %v\n", err)
+		}
+		httpClient = transport.Client()
+		httpClient.Timeout = *requestTimeout
+	}
+
+	categorizer, err := newProvider(httpClient)
+	if err != nil {
+		logme.FatalF("Error setting up provider: %v\n", err)
+	}
+
+	ctx := context.Background()
+	gh := github.NewClient(github.Config{
+		BaseURL:          *githubURL,
+		Tokens:           newTokenSource(),
+		HTTPClient:       httpClient,
+		MaxRateLimitWait: *maxRateLimitWait,
+	})
+
+	t := &triager{
+		gh: gh,
+		categorizer: &triage.Categorizer{
+			Provider:       categorizer,
+			Model:          *categorizerModel,
+			Prompt:         string(prompt),
+			CategoryLabels: categoryLabels,
+			TypeLabels:     typeLabels,
+			Retry: llm.RetryPolicy{
+				Attempts:  *retries,
+				BaseDelay: llm.DefaultRetryPolicy.BaseDelay,
+				MaxDelay:  *maxRetryDelay,
+			},
+
+			ConfidenceThreshold: *confidenceThreshold,
+			DiscussionTokens:    *discussionTokens,
+			CommentMarker:       commentMarker,
+			ManagedLabel:        isTriagerLabel,
+			MaxInputTokens:      *maxInputTokens,
+			Encoding:            tokenizer.Encoding(*encoding),
+			Prices:              prices,
+			Github:              gh,
+		},
+	}
+
+	if *serveAddr != "" {
+		err = t.serve(ctx, *serveAddr, *webhookSecret, *queueDir)
+		if err != nil {
+			logme.FatalF("Error running webhook server: %v\n", err)
+		}
+		return
+	}
+
+	if *query != "" {
+		err = t.triageBatch(ctx, *query)
+		if err != nil {
+			logme.FatalF("Error running batch triage: %v\n", err)
+		}
+		return
 	}
 
-	issueData, err := github.FetchIssueDetails(*issueId, *repo)
+	issueData, err := gh.FetchIssueDetails(ctx, *issueId, *repo)
 	if err != nil {
 		logme.FatalF("Error fetching issue details: %v\n", err)
 	}
@@ -101,106 +400,353 @@ func main() {
 		logme.FatalLn("Error fetching issue details: Title is empty")
 	}
 
-	logme.InfoF(":: Categorizing issue\n")
-	logme.DebugF("Repo: %s\n", *repo)
-	logme.DebugF("Issue ID: %d\n", *issueId)
-	logme.DebugF("Model: %s\n", *categorizerModel)
-	logme.DebugF("Issue title: %s\n", issueData.Title)
+	category, err := t.triageIssue(ctx, &issueData)
+	if err != nil {
+		logme.FatalF("Error triaging issue: %v\n", err)
+	}
+
+	categoryJson, err := json.Marshal(category)
+	if err != nil {
+		logme.FatalF("Error marshalling category: %v\n", err)
+	}
+
+	fmt.Printf("%s", categoryJson)
+
+}
 
-	leftRetries := *retries
-	category := CategorizedIssue{}
+// triager holds the clients shared by every issue triaged in a run
+type triager struct {
+	gh          *github.Client
+	categorizer *triage.Categorizer
+}
 
-	for leftRetries > 0 {
-		category, err = getIssueCategory(&issueData, categorizerModel, typeLabels, categoryLabels)
-		if err != nil || category.ID == 0 || category.ID == nil {
-			retriesLeft := leftRetries - 1
-			logme.ErrorF("Error categorizing issue: %v\n", err)
-			logme.InfoF("Retrying in 1 second. %d retries left\n", retriesLeft)
-			time.Sleep(time.Second)
-			leftRetries = retriesLeft
-			continue
+// triageIssue categorizes the issue and plans the changes to make to it. The
+// plan is printed with -dryRun and applied otherwise.
+func (t *triager) triageIssue(ctx context.Context, issueData *github.Issue) (triage.CategorizedIssue, error) {
+	category, err := t.categorizer.Categorize(ctx, issueData)
+	if err != nil {
+		// category only holds the usage of the failed requests
+		return category, err
+	}
+
+	plan, err := t.planIssue(ctx, issueData, &category)
+	if err != nil {
+		return category, err
+	}
+	category.Plan = &plan
+
+	if *dryRun {
+		fmt.Fprint(os.Stderr, plan.String())
+		return category, nil
+	}
+
+	return category, t.applyPlan(ctx, plan)
+}
+
+// planIssue computes the changes to the issue: the labels when -addLabels or
+// -dryRun are set, and the comment when -comment (or -commentNotCategorizable
+// for issues that can't be categorized) is set. The explanation comment lists
+// the applied labels, so it is only planned with the labels.
+func (t *triager) planIssue(ctx context.Context, issueData *github.Issue, category *triage.CategorizedIssue) (triage.Plan, error) {
+	issueRepo := issueData.Repo()
+	if issueRepo == "" {
+		issueRepo = *repo
+	}
+
+	plan := triage.Plan{
+		Repo:         issueRepo,
+		IssueID:      issueData.Number,
+		IssueNodeID:  issueData.NodeID,
+		AddLabels:    []string{},
+		RemoveLabels: []string{},
+	}
+
+	labels := []string{}
+	if category.IsCategorizable {
+		labels = append(labels, category.CategoryLabel...)
+		labels = append(labels, category.TypeLabel...)
+		labels = append(labels, triageConfig.RoutedLabels(labels)...)
+		labels = append(labels, "automated-triage")
+		if category.NeedsReview && *reviewLabel != "" {
+			logme.InfoF("Low confidence labels %v. Routing issue to review\n", category.LowConfidenceLabels)
+			labels = append(labels, *reviewLabel)
 		}
+	} else if *notCategorizableLabel != "" {
+		labels = append(labels, *notCategorizableLabel, "automated-triage")
+	}
 
-		// filter out the categories that are not in the categoryLabels
-		realCategories := []string{}
-		for _, category := range category.CategoryLabel {
-			if slices.Contains(categoryLabels, category) {
-				realCategories = append(realCategories, category)
-			} else {
-				logme.DebugF("Category %s is not in categoryLabels. Skipping", category)
+	if (*addLabels || *dryRun) && len(labels) > 0 {
+		var err error
+		if *validateLabels {
+			labels, err = t.knownLabels(ctx, issueRepo, labels, category)
+			if err != nil {
+				return plan, err
 			}
 		}
 
-		if len(realCategories) == 0 {
-			logme.ErrorF("Error categorizing issue: Model returned only false categories")
-			retriesLeft := leftRetries - 1
-			logme.InfoF("Retrying in 1 second. %d retries left\n", retriesLeft)
-			time.Sleep(time.Second)
-			leftRetries = retriesLeft
-			continue
+		// without -retriage no label is removed
+		managed := func(string) bool { return false }
+		if *retriage {
+			managed = isManagedLabel
 		}
 
-		category.CategoryLabel = realCategories
+		current := []string{}
+		for _, label := range issueData.Labels {
+			current = append(current, label.Name)
+		}
+		plan.AddLabels, plan.RemoveLabels = triage.DiffLabels(current, labels, managed)
 
-		// filter out the labels that are not in the typeLabels
-		realTypes := []string{}
-		for _, typeLabel := range category.TypeLabel {
-			if slices.Contains(typeLabels, typeLabel) {
-				realTypes = append(realTypes, typeLabel)
-			} else {
-				logme.DebugF("Type %s is not in typeLabels. Skipping", typeLabel)
+		for _, project := range triageConfig.RoutedProjects(labels) {
+			org, number, err := config.ParseProject(project)
+			if err != nil {
+				return plan, err
 			}
+			plan.Projects = append(plan.Projects, triage.ProjectAssignment{Org: org, Number: number})
 		}
+	}
+
+	var err error
+	if category.IsCategorizable && *comment && (*addLabels || *dryRun) {
+		plan.Comment, err = renderComment(triageConfig.Comments.Explanation, *category, explanationComment)
+	} else if !category.IsCategorizable && *commentNotCategorizable {
+		plan.Comment, err = renderComment(triageConfig.Comments.NotCategorizable, *category, notCategorizableComment)
+	}
+	if err != nil {
+		return plan, err
+	}
 
-		category.TypeLabel = realTypes
-		category.Remarks = sanitize.AlphaNumeric(category.Remarks, true)
+	return plan, nil
+}
 
-		break
+// applyPlan makes exactly the changes of the plan
+func (t *triager) applyPlan(ctx context.Context, plan triage.Plan) error {
+	if len(plan.AddLabels) > 0 {
+		logme.InfoF("Adding labels %v to issue\n", plan.AddLabels)
+		err := t.gh.AddLabelsToIssue(ctx, plan.Repo, plan.IssueID, plan.AddLabels)
+		if err != nil {
+			return fmt.Errorf("error adding labels to issue: %w", err)
+		}
 	}
 
-	if leftRetries == 0 && err != nil {
-		logme.FatalF("Error categorizing issue: %v\n", err)
+	for _, label := range plan.RemoveLabels {
+		logme.InfoF("Removing label %s from issue\n", label)
+		err := t.gh.RemoveLabelFromIssue(ctx, plan.Repo, plan.IssueID, label)
+		if err != nil {
+			return fmt.Errorf("error removing label %s from issue: %w", label, err)
+		}
 	}
 
-	logme.InfoF("Finished categorizing issue")
+	for _, project := range plan.Projects {
+		logme.InfoF("Adding issue to project %s\n", project)
+		projectNodeId, err := t.gh.GetProjectNodeId(ctx, project.Org, project.Number)
+		if err != nil {
+			return fmt.Errorf("error getting project %s: %w", project, err)
+		}
+		err = t.gh.AssignProjectToIssue(ctx, plan.IssueNodeID, projectNodeId)
+		if err != nil {
+			return fmt.Errorf("error adding issue to project %s: %w", project, err)
+		}
+	}
 
-	if *addLabels {
-		logme.InfoF("Adding labels to issue")
+	if plan.Comment != "" {
+		logme.InfoF("Commenting on issue")
+		_, err := t.gh.UpsertIssueComment(ctx, plan.Repo, plan.IssueID, commentMarker, plan.Comment)
+		if err != nil {
+			return fmt.Errorf("error commenting on issue: %w", err)
+		}
+	}
 
-		labels := []string{}
-		labels = append(labels, category.CategoryLabel...)
-		labels = append(labels, category.TypeLabel...)
-		labels = append(labels, "automated-triage")
-		err = github.AddLabelsToIssue(*repo, *issueId, labels)
+	return nil
+}
+
+// applyPlanFile applies the plans of a file with one or more JSON plans, such
+// as the plan of a dry run
+func (t *triager) applyPlanFile(ctx context.Context, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	for {
+		var plan triage.Plan
+		err := decoder.Decode(&plan)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading plan: %w", err)
+		}
+		if plan.Repo == "" || plan.IssueID == 0 {
+			return fmt.Errorf("plan without repo or issueId")
+		}
+		if len(plan.Projects) > 0 && plan.IssueNodeID == "" {
+			return fmt.Errorf("plan for %s#%d assigns projects without issueNodeId", plan.Repo, plan.IssueID)
+		}
+
+		fmt.Fprint(os.Stderr, plan.String())
+		err = t.applyPlan(ctx, plan)
 		if err != nil {
-			logme.FatalF("Error adding labels to issue: %v\n", err)
+			return fmt.Errorf("error applying plan for %s#%d: %w", plan.Repo, plan.IssueID, err)
+		}
+	}
+}
+
+// isManagedLabel reports whether the label matches one of -managedLabels or is
+// the -reviewLabel or -notCategorizableLabel, which only the triager applies
+func isManagedLabel(label string) bool {
+	for _, triagerLabel := range []string{*reviewLabel, *notCategorizableLabel} {
+		if triagerLabel != "" && strings.EqualFold(label, triagerLabel) {
+			return true
+		}
+	}
+	for _, pattern := range strings.Split(*managedLabels, ",") {
+		if config.MatchLabel(strings.TrimSpace(pattern), label) {
+			return true
 		}
-		logme.InfoF("Finished adding labels to issue")
 	}
+	return false
+}
 
-	categoryJson, err := json.Marshal(category)
+// errUnknownLabels fails the issues with labels missing from the repo with
+// -strictLabels
+var errUnknownLabels = errors.New("labels don't exist")
+
+// knownLabels drops the labels that don't exist in the repo, so typos in the
+// label files or the config don't create new labels. With -strictLabels
+// unknown labels are an error instead.
+func (t *triager) knownLabels(ctx context.Context, issueRepo string, labels []string, category *triage.CategorizedIssue) ([]string, error) {
+	unknown, err := t.gh.UnknownLabels(ctx, issueRepo, labels)
 	if err != nil {
-		logme.FatalF("Error marshalling category: %v\n", err)
+		return nil, fmt.Errorf("error validating labels: %w", err)
+	}
+	if len(unknown) == 0 {
+		return labels, nil
 	}
 
-	fmt.Printf("%s", categoryJson)
+	category.UnknownLabels = unknown
+	if *strictLabels {
+		return nil, fmt.Errorf("%w in %s: %s", errUnknownLabels, issueRepo, strings.Join(unknown, ", "))
+	}
 
+	logme.ErrorF("Skipping labels that don't exist in %s: %s\n", issueRepo, strings.Join(unknown, ", "))
+	isUnknown := func(label string) bool {
+		return slices.Contains(unknown, label)
+	}
+	category.CategoryLabel = slices.DeleteFunc(category.CategoryLabel, isUnknown)
+	category.TypeLabel = slices.DeleteFunc(category.TypeLabel, isUnknown)
+
+	return slices.DeleteFunc(labels, isUnknown), nil
+}
+
+// loadConfig reads -config and uses its values for the flags that were not
+// set on the command line
+func loadConfig() error {
+	if *configFile == "" {
+		return nil
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		return err
+	}
+
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	for name, value := range cfg.FlagValues() {
+		if set[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %w", value, name, err)
+		}
+	}
+
+	triageConfig = cfg
+
+	return nil
 }
 
 func validateFlags() error {
-	if *issueId == 0 {
-		return fmt.Errorf("issueId is required")
+	modes := 0
+	for _, set := range []bool{*issueId != 0, *query != "", *serveAddr != ""} {
+		if set {
+			modes++
+		}
+	}
+	if modes == 0 {
+		return fmt.Errorf("issueId, query or serve is required")
+	}
+	if modes > 1 {
+		return fmt.Errorf("issueId, query and serve are mutually exclusive")
 	}
 
-	if openAiKey == "" {
-		return fmt.Errorf("OPENAI_API_KEY env var is required")
+	if *maxAttempts < 1 {
+		return fmt.Errorf("maxAttempts must be at least 1")
 	}
 
-	if ghToken == "" {
-		return fmt.Errorf("GH_TOKEN env var is required")
+	if *jobTimeout <= 0 || *requestTimeout <= 0 {
+		return fmt.Errorf("jobTimeout and requestTimeout must be positive")
+	}
+	if *requestTimeout <= *maxRateLimitWait {
+		return fmt.Errorf("requestTimeout must be longer than maxRateLimitWait")
+	}
+
+	if *serveAddr != "" && *webhookSecret == "" {
+		return fmt.Errorf("webhookSecret or GITHUB_WEBHOOK_SECRET env var is required to serve webhooks")
+	}
+
+	if *confidenceThreshold < 0 || *confidenceThreshold > 1 {
+		return fmt.Errorf("confidenceThreshold must be between 0 and 1")
 	}
 
-	_, err := os.Stat(*labelsFile)
+	if *encoding != "" {
+		_, err := tokenizer.Get(tokenizer.Encoding(*encoding))
+		if err != nil {
+			return fmt.Errorf("unknown tokenizer %s", *encoding)
+		}
+	}
+
+	if *maxInputTokens < 0 {
+		return fmt.Errorf("maxInputTokens can't be negative")
+	}
+
+	if *discussionTokens < 0 {
+		return fmt.Errorf("discussionTokens can't be negative")
+	}
+
+	if *concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+
+	keyEnv, ok := llm.APIKeyEnvs[*provider]
+	if !ok {
+		return fmt.Errorf("unknown provider %s", *provider)
+	}
+
+	if *cassetteDir != "" && *cassetteMode != cassette.ModeRecord && *cassetteMode != cassette.ModeReplay {
+		return fmt.Errorf("cassetteMode must be %s or %s", cassette.ModeRecord, cassette.ModeReplay)
+	}
+
+	// replaying never touches the network so no credentials are needed
+	replaying := *cassetteDir != "" && *cassetteMode == cassette.ModeReplay
+
+	// ollama and other local servers usually run without authentication, and
+	// gateways can authenticate via -header instead of a provider key
+	if !replaying && *provider != llm.ProviderOllama && *baseURL == "" && os.Getenv(keyEnv) == "" {
+		return fmt.Errorf("%s env var is required", keyEnv)
+	}
+
+	err := validateGithubAuth(replaying)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stat(*labelsFile)
 	if os.IsNotExist(err) {
 		return fmt.Errorf("labelsFile %s does not exist", *labelsFile)
 	}
@@ -218,115 +764,69 @@ func validateFlags() error {
 	return nil
 }
 
-func readFileLines(s string) ([]string, error) {
-	file, err := os.Open(s)
-	if err != nil {
-		return nil, err
+func validateGithubAuth(replaying bool) error {
+	if replaying {
+		return nil
 	}
-	defer file.Close()
 
-	var lines []string
+	if *appId != 0 {
+		if *appPrivateKey == "" {
+			return fmt.Errorf("appPrivateKey is required when using a GitHub App")
+		}
+		_, err := os.Stat(*appPrivateKey)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("appPrivateKey %s does not exist", *appPrivateKey)
+		}
+		return nil
+	}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+	if ghToken == "" {
+		return fmt.Errorf("GH_TOKEN env var is required")
 	}
-	return lines, nil
 
+	return nil
 }
 
-func getIssueCategory(
-	issueData *github.Issue,
-	model *string,
-	typeLabels []string,
-	categoryLabels []string,
-) (CategorizedIssue, error) {
-
-	prompt, err := os.ReadFile(*promptFile)
-	if err != nil {
-		return CategorizedIssue{}, err
+func envOrDefault(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
 	}
+	return fallback
+}
 
-	categoryzerPrompt := string(prompt)
-
-	// calculate the number of tokens
-	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+func envInt64(name string) int64 {
+	value, err := strconv.ParseInt(os.Getenv(name), 10, 64)
 	if err != nil {
-		return CategorizedIssue{}, err
+		return 0
 	}
+	return value
+}
 
-	tokens, _, err := enc.Encode(categoryzerPrompt)
-	if err != nil {
-		return CategorizedIssue{}, err
+// newTokenSource authenticates as the GitHub App when one is configured and
+// falls back to GH_TOKEN otherwise
+func newTokenSource() github.TokenSource {
+	if *appId == 0 || *cassetteMode == cassette.ModeReplay && *cassetteDir != "" {
+		return github.StaticToken(ghToken)
 	}
 
-	logme.DebugF("Tokens: %d\n", len(tokens))
+	// the app client is never recorded so installation tokens don't end up in
+	// the cassette
+	appClient := github.NewClient(github.Config{BaseURL: *githubURL})
+	return github.NewAppTokenSource(appClient, *appId, *appPrivateKey, *appInstallationId, *repo)
+}
 
-	// set up structured output schema
-	type Result struct {
-		ID              int      `json:"id"`
-		IsCategorizable bool     `json:"isCategorizable"`
-		Remarks         string   `json:"remarks"`
-		CategoryLabel   []string `json:"categoryLabel"`
-		TypeLabel       []string `json:"typeLabel"`
-	}
+func newProvider(httpClient *http.Client) (llm.Provider, error) {
+	cfg := llm.ConfigFromEnv(*provider)
+	cfg.Headers = http.Header(extraHeaders)
+	cfg.HTTPClient = httpClient
 
-	var result Result
-	schema, err := jsonschema.GenerateSchemaForType(result)
-	if err != nil {
-		log.Fatalf("GenerateSchemaForType error: %v", err)
-	}
-
-	client := openai.NewClient(openAiKey)
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: *model,
-			// ResponseFormat: &openai.ChatCompletionResponseFormat{
-			// 	Type: openai.ChatCompletionResponseFormatTypeJSONObject,
-			// },
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: categoryzerPrompt,
-				},
-				{
-					Role: openai.ChatMessageRoleUser,
-					Content: `
-					  Issue ID: ` + strconv.Itoa(*issueId) + `
-					  Issue title: ` + issueData.Title + `
-					  Issue description:\n\n ` + issueData.Body + `
-
-						According to the following list, which category and type do you think this issue belongs to?
-
-					List of categories:
-					` + strings.Join(categoryLabels, "\n") +
-						`
-					List of types: ` + strings.Join(typeLabels, "\n"),
-				},
-			},
-			ResponseFormat: &openai.ChatCompletionResponseFormat{
-				Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
-				JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
-					Name:   "math_reasoning",
-					Schema: schema,
-					Strict: true,
-				},
-			},
-		},
-	)
-
-	if err != nil {
-		logme.FatalF("ChatCompletion error: %v\n", err)
-		return CategorizedIssue{}, err
+	if *organization != "" {
+		cfg.Organization = *organization
 	}
 
-	category := CategorizedIssue{}
-	err = json.Unmarshal([]byte(resp.Choices[0].Message.Content), &category)
-	if err != nil {
-		return CategorizedIssue{}, fmt.Errorf("error unmarshaling issue category: %w", err)
+	if *baseURL != "" {
+		cfg.BaseURL = *baseURL
 	}
 
-	return category, nil
-
+	return llm.NewProvider(cfg)
 }
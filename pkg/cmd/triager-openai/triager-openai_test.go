@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/grafana/auto-triage/pkg/cassette"
+	"github.com/grafana/auto-triage/pkg/github"
+	"github.com/grafana/auto-triage/pkg/llm"
+	"github.com/grafana/auto-triage/pkg/triage"
+)
+
+// fixtures is the fixtures directory at the root of the repo
+const fixtures = "../../../fixtures/"
+
+// replayTriager returns a triager set up like main with the default flags,
+// replaying the responses of the cassette
+func replayTriager(t *testing.T, cassetteDir string) *triager {
+	t.Helper()
+
+	transport, err := cassette.New(fixtures+"cassettes/"+cassetteDir, cassette.ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpClient := transport.Client()
+
+	categoryLabels, err := triage.ReadCatalog(fixtures + "categoryLabels.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	typeLabels, err := triage.ReadCatalog(fixtures + "typeLabels.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompt, err := os.ReadFile(fixtures + "prompt.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := llm.NewProvider(llm.Config{Provider: llm.ProviderOpenAI, APIKey: "replayed", HTTPClient: httpClient})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gh := github.NewClient(github.Config{Tokens: github.StaticToken("replayed"), HTTPClient: httpClient})
+
+	return &triager{
+		gh: gh,
+		categorizer: &triage.Categorizer{
+			Provider:       provider,
+			Model:          *categorizerModel,
+			Prompt:         string(prompt),
+			CategoryLabels: categoryLabels,
+			TypeLabels:     typeLabels,
+			Retry:          llm.RetryPolicy{Attempts: 1},
+			CommentMarker:  commentMarker,
+			Prices:         llm.DefaultPrices,
+			Github:         gh,
+		},
+	}
+}
+
+// TestTriageIssueReplay replays a dry run recorded with -dryRun -cassetteMode
+// record. Record it again, and update the expected plan, when the prompt, the
+// label files or the requests change.
+func TestTriageIssueReplay(t *testing.T) {
+	*dryRun = true
+	t.Cleanup(func() { *dryRun = false })
+
+	tr := replayTriager(t, "98765")
+	ctx := context.Background()
+
+	issue, err := tr.gh.FetchIssueDetails(ctx, 98765, "grafana/grafana")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	category, err := tr.triageIssue(ctx, &issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !category.IsCategorizable || !reflect.DeepEqual(category.CategoryLabel, []string{"area/alerting"}) || !reflect.DeepEqual(category.TypeLabel, []string{"type/bug"}) {
+		t.Errorf("got category %+v, want area/alerting and type/bug", category)
+	}
+
+	want := triage.Plan{
+		Repo:         "grafana/grafana",
+		IssueID:      98765,
+		IssueNodeID:  "I_kwDOAOaWjc6abcde",
+		AddLabels:    []string{"area/alerting", "type/bug", "automated-triage"},
+		RemoveLabels: []string{},
+	}
+	if category.Plan == nil || !reflect.DeepEqual(*category.Plan, want) {
+		t.Errorf("got plan %+v, want %+v", category.Plan, want)
+	}
+
+	if category.Usage.Requests != 1 || category.Usage.PromptTokens != 1843 {
+		t.Errorf("got usage %+v, want the recorded request", category.Usage)
+	}
+}
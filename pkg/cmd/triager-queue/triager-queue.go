@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/grafana/auto-triage/pkg/logme"
+	"github.com/grafana/auto-triage/pkg/queue"
+)
+
+var (
+	queueDir = flag.String(
+		"queue",
+		"out/queue",
+		"Directory of the queue of the triager-openai webhook server",
+	)
+	olderThan = flag.Duration(
+		"olderThan",
+		0,
+		"Only purge the jobs last updated longer ago than this, e.g. 24h",
+	)
+)
+
+const usage = `Usage: triager-queue [flags] <command>
+
+Commands:
+  list [status]        List the jobs, all or with the status (pending, running, done, dead)
+  show <id>            Print the job as JSON
+  retry <id>...        Make the jobs pending again, with their attempts reset
+  retry dead           Retry all the dead jobs
+  purge <status>       Delete the jobs with the status (done, dead or pending)
+
+Flags:
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	q, err := queue.Open(*queueDir)
+	if err != nil {
+		logme.FatalF("Error opening queue: %v\n", err)
+	}
+
+	switch args[0] {
+	case "list":
+		err = list(q, args[1:])
+	case "show":
+		err = show(q, args[1:])
+	case "retry":
+		err = retry(q, args[1:])
+	case "purge":
+		err = purge(q, args[1:])
+	default:
+		err = fmt.Errorf("unknown command %q", args[0])
+	}
+	if err != nil {
+		logme.FatalF("Error: %v\n", err)
+	}
+}
+
+func parseStatus(s string) (queue.Status, error) {
+	status := queue.Status(s)
+	if !slices.Contains(queue.Statuses, status) {
+		return "", fmt.Errorf("unknown status %q, must be one of %v", s, queue.Statuses)
+	}
+	return status, nil
+}
+
+func list(q *queue.Queue, args []string) error {
+	statuses := queue.Statuses
+	if len(args) > 0 {
+		status, err := parseStatus(args[0])
+		if err != nil {
+			return err
+		}
+		statuses = []queue.Status{status}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tISSUE\tATTEMPTS\tNEXT ATTEMPT\tUPDATED\tLAST ERROR")
+	for _, status := range statuses {
+		jobs, err := q.List(status)
+		if err != nil {
+			return err
+		}
+
+		for _, job := range jobs {
+			next := "-"
+			if job.Status == queue.StatusPending {
+				next = job.NextAttempt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(
+				w,
+				"%s\t%s\t%s#%d\t%d\t%s\t%s\t%s\n",
+				job.ID,
+				job.Status,
+				job.Repo,
+				job.IssueID,
+				job.Attempts,
+				next,
+				job.UpdatedAt.Format(time.RFC3339),
+				job.LastError,
+			)
+		}
+	}
+
+	return w.Flush()
+}
+
+func show(q *queue.Queue, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("show takes a job ID")
+	}
+
+	job, err := q.Get(args[0])
+	if err != nil {
+		return err
+	}
+
+	output, err := json.MarshalIndent(struct {
+		queue.Job
+		Status queue.Status `json:"status"`
+	}{job, job.Status}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(output))
+	return nil
+}
+
+func retry(q *queue.Queue, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("retry takes job IDs or dead")
+	}
+
+	ids := args
+	if len(args) == 1 && args[0] == string(queue.StatusDead) {
+		jobs, err := q.List(queue.StatusDead)
+		if err != nil {
+			return err
+		}
+		ids = []string{}
+		for _, job := range jobs {
+			ids = append(ids, job.ID)
+		}
+	}
+
+	for _, id := range ids {
+		if err := q.Retry(id); err != nil {
+			return fmt.Errorf("error retrying %s: %w", id, err)
+		}
+		logme.InfoF("Retrying %s\n", id)
+	}
+
+	return nil
+}
+
+func purge(q *queue.Queue, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("purge takes a status")
+	}
+
+	status, err := parseStatus(args[0])
+	if err != nil {
+		return err
+	}
+	if status == queue.StatusRunning {
+		return fmt.Errorf("running jobs can't be purged")
+	}
+
+	purged, err := q.Purge(status, time.Now().Add(-*olderThan))
+	if err != nil {
+		return err
+	}
+
+	logme.InfoF("Purged %d %s jobs\n", purged, status)
+	return nil
+}
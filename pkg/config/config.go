@@ -0,0 +1,331 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/grafana/auto-triage/pkg/llm"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the triage policy of a repository. Every field is optional; the
+// fields that map to a command flag are only used when the flag is not set on
+// the command line.
+type Config struct {
+	Repo                  string   `yaml:"repo" json:"repo"`
+	Provider              string   `yaml:"provider" json:"provider"`
+	Model                 string   `yaml:"model" json:"model"`
+	BaseURL               string   `yaml:"baseURL" json:"baseURL"`
+	PromptFile            string   `yaml:"promptFile" json:"promptFile"`
+	LabelsFile            string   `yaml:"labelsFile" json:"labelsFile"`
+	TypesFile             string   `yaml:"typesFile" json:"typesFile"`
+	PricesFile            string   `yaml:"pricesFile" json:"pricesFile"`
+	Retries               *int     `yaml:"retries" json:"retries"`
+	ConfidenceThreshold   *float64 `yaml:"confidenceThreshold" json:"confidenceThreshold"`
+	MaxInputTokens        *int     `yaml:"maxInputTokens" json:"maxInputTokens"`
+	DiscussionTokens      *int     `yaml:"discussionTokens" json:"discussionTokens"`
+	ReviewLabel           string   `yaml:"reviewLabel" json:"reviewLabel"`
+	NotCategorizableLabel string   `yaml:"notCategorizableLabel" json:"notCategorizableLabel"`
+
+	// ExcludedLabels are never sent to the model nor applied. Entries are
+	// label patterns (see MatchLabel) such as "area/backend/*".
+	ExcludedLabels []string `yaml:"excludedLabels" json:"excludedLabels"`
+	// ManagedLabels are the label patterns owned by the triager, which are
+	// removed on re-triage when no longer predicted
+	ManagedLabels []string `yaml:"managedLabels" json:"managedLabels"`
+	// Comments overrides the comment templates
+	Comments CommentTemplates `yaml:"comments" json:"comments"`
+	// Routes add labels to the issues matching them
+	Routes []Route `yaml:"routes" json:"routes"`
+}
+
+// CommentTemplates are text/template templates rendered with the
+// categorization result (triage.CategorizedIssue)
+type CommentTemplates struct {
+	Explanation      string `yaml:"explanation" json:"explanation"`
+	NotCategorizable string `yaml:"notCategorizable" json:"notCategorizable"`
+}
+
+// Route adds AddLabels to the issues with an applied label matching Match, a
+// label pattern (see MatchLabel) such as "area/alerting*", and adds them to
+// Project, an organization project in the form "org/number"
+type Route struct {
+	Match     string   `yaml:"match" json:"match"`
+	AddLabels []string `yaml:"addLabels" json:"addLabels"`
+	Project   string   `yaml:"project" json:"project"`
+}
+
+// Load reads a YAML or JSON (by the .json extension) config file and validates
+// it
+func Load(file string) (Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var cfg Config
+	if filepath.Ext(file) == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&cfg)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&cfg)
+		// an empty file is an empty config
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("error parsing config %s: %w", file, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid config %s:\n%w", file, err)
+	}
+
+	return cfg, nil
+}
+
+// Validate reports every problem of the config at once
+func (cfg Config) Validate() error {
+	errs := []error{}
+
+	if cfg.Provider != "" && !slices.Contains(llm.Providers, cfg.Provider) {
+		errs = append(errs, fmt.Errorf("provider: unknown provider %q, must be one of %v", cfg.Provider, llm.Providers))
+	}
+
+	for name, file := range map[string]string{
+		"promptFile": cfg.PromptFile,
+		"labelsFile": cfg.LabelsFile,
+		"typesFile":  cfg.TypesFile,
+		"pricesFile": cfg.PricesFile,
+	} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s does not exist", name, file))
+		}
+	}
+
+	if cfg.Retries != nil && *cfg.Retries < 1 {
+		errs = append(errs, fmt.Errorf("retries: must be at least 1"))
+	}
+
+	if cfg.ConfidenceThreshold != nil && (*cfg.ConfidenceThreshold < 0 || *cfg.ConfidenceThreshold > 1) {
+		errs = append(errs, fmt.Errorf("confidenceThreshold: must be between 0 and 1"))
+	}
+
+	if cfg.MaxInputTokens != nil && *cfg.MaxInputTokens < 0 {
+		errs = append(errs, fmt.Errorf("maxInputTokens: can't be negative"))
+	}
+
+	if cfg.DiscussionTokens != nil && *cfg.DiscussionTokens < 0 {
+		errs = append(errs, fmt.Errorf("discussionTokens: can't be negative"))
+	}
+
+	for i, pattern := range cfg.ExcludedLabels {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("excludedLabels[%d]: invalid pattern %q", i, pattern))
+		}
+	}
+
+	for i, pattern := range cfg.ManagedLabels {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("managedLabels[%d]: invalid pattern %q", i, pattern))
+		} else if strings.Contains(pattern, ",") {
+			errs = append(errs, fmt.Errorf("managedLabels[%d]: patterns can't contain commas", i))
+		}
+	}
+
+	for name, text := range map[string]string{
+		"comments.explanation":      cfg.Comments.Explanation,
+		"comments.notCategorizable": cfg.Comments.NotCategorizable,
+	} {
+		if _, err := template.New(name).Parse(text); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	for i, route := range cfg.Routes {
+		if route.Match == "" {
+			errs = append(errs, fmt.Errorf("routes[%d]: match is required", i))
+		} else if _, err := path.Match(route.Match, ""); err != nil {
+			errs = append(errs, fmt.Errorf("routes[%d]: invalid pattern %q", i, route.Match))
+		}
+		if len(route.AddLabels) == 0 && route.Project == "" {
+			errs = append(errs, fmt.Errorf("routes[%d]: addLabels or project is required", i))
+		}
+		if route.Project != "" {
+			if _, _, err := ParseProject(route.Project); err != nil {
+				errs = append(errs, fmt.Errorf("routes[%d]: %w", i, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// FlagValues returns the config values that map to a command flag, keyed by
+// flag name. Unset values are left out.
+func (cfg Config) FlagValues() map[string]string {
+	values := map[string]string{
+		"repo":                  cfg.Repo,
+		"provider":              cfg.Provider,
+		"categorizerModel":      cfg.Model,
+		"baseURL":               cfg.BaseURL,
+		"promptFile":            cfg.PromptFile,
+		"labelsFile":            cfg.LabelsFile,
+		"typesFile":             cfg.TypesFile,
+		"pricesFile":            cfg.PricesFile,
+		"reviewLabel":           cfg.ReviewLabel,
+		"notCategorizableLabel": cfg.NotCategorizableLabel,
+	}
+
+	if len(cfg.ManagedLabels) > 0 {
+		values["managedLabels"] = strings.Join(cfg.ManagedLabels, ",")
+	}
+	if cfg.Retries != nil {
+		values["retries"] = strconv.Itoa(*cfg.Retries)
+	}
+	if cfg.ConfidenceThreshold != nil {
+		values["confidenceThreshold"] = strconv.FormatFloat(*cfg.ConfidenceThreshold, 'f', -1, 64)
+	}
+	if cfg.MaxInputTokens != nil {
+		values["maxInputTokens"] = strconv.Itoa(*cfg.MaxInputTokens)
+	}
+	if cfg.DiscussionTokens != nil {
+		values["discussionTokens"] = strconv.Itoa(*cfg.DiscussionTokens)
+	}
+
+	for name, value := range values {
+		if value == "" {
+			delete(values, name)
+		}
+	}
+
+	return values
+}
+
+// MatchLabel reports whether label matches pattern. Patterns use path.Match
+// syntax, and a pattern ending in "/*" also matches the nested labels, so
+// "area/*" matches "area/panel/trend".
+func MatchLabel(pattern string, label string) bool {
+	if ok, _ := path.Match(pattern, label); ok {
+		return true
+	}
+
+	if !strings.HasSuffix(pattern, "/*") {
+		return false
+	}
+
+	// "area/*" matches "area/panel/trend" because it matches "area/panel"
+	for i := range len(label) {
+		if label[i] == '/' {
+			if ok, _ := path.Match(pattern, label[:i]); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsExcluded reports whether label matches one of the ExcludedLabels
+func (cfg Config) IsExcluded(label string) bool {
+	for _, pattern := range cfg.ExcludedLabels {
+		if MatchLabel(pattern, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoutedLabels returns the labels added by the routes matching any of labels
+func (cfg Config) RoutedLabels(labels []string) []string {
+	routed := []string{}
+	for _, route := range cfg.Routes {
+		for _, label := range labels {
+			if MatchLabel(route.Match, label) {
+				for _, add := range route.AddLabels {
+					if !slices.Contains(routed, add) {
+						routed = append(routed, add)
+					}
+				}
+				break
+			}
+		}
+	}
+	return routed
+}
+
+// IsRouteLabel reports whether label is added by any of the routes
+func (cfg Config) IsRouteLabel(label string) bool {
+	for _, route := range cfg.Routes {
+		for _, add := range route.AddLabels {
+			if strings.EqualFold(add, label) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RoutedProjects returns the projects of the routes matching any of labels
+func (cfg Config) RoutedProjects(labels []string) []string {
+	projects := []string{}
+	for _, route := range cfg.Routes {
+		if route.Project == "" || slices.Contains(projects, route.Project) {
+			continue
+		}
+		for _, label := range labels {
+			if MatchLabel(route.Match, label) {
+				projects = append(projects, route.Project)
+				break
+			}
+		}
+	}
+	return projects
+}
+
+// ParseProject splits a project in the form "org/number"
+func ParseProject(project string) (string, int, error) {
+	org, number, ok := strings.Cut(project, "/")
+	n, err := strconv.Atoi(number)
+	if !ok || org == "" || err != nil || n <= 0 {
+		return "", 0, fmt.Errorf("invalid project %q, must be in the form org/number", project)
+	}
+	return org, n, nil
+}
+
+// ReferencedLabels returns the labels the config applies to issues: the
+// review and not categorizable labels and the labels added by the routes
+func (cfg Config) ReferencedLabels() []string {
+	labels := []string{}
+	add := func(label string) {
+		if label != "" && !slices.Contains(labels, label) {
+			labels = append(labels, label)
+		}
+	}
+
+	add(cfg.ReviewLabel)
+	add(cfg.NotCategorizableLabel)
+	for _, route := range cfg.Routes {
+		for _, label := range route.AddLabels {
+			add(label)
+		}
+	}
+
+	return labels
+}
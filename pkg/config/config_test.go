@@ -0,0 +1,30 @@
+package config
+
+import "testing"
+
+func TestMatchLabel(t *testing.T) {
+	tests := []struct {
+		pattern string
+		label   string
+		want    bool
+	}{
+		{"area/alerting", "area/alerting", true},
+		{"area/alerting", "area/alerting/notifications", false},
+		{"area/*", "area/alerting", true},
+		{"area/*", "area/panel/trend", true},
+		{"area/*", "area", false},
+		{"area/*", "type/bug", false},
+		{"area/alerting*", "area/alerting-ng", true},
+		{"area/alerting*", "area/alerting/notifications", false},
+		{"area/backend/*", "area/backend/db/mysql", true},
+		{"area/backend/*", "area/frontend/db", false},
+		{"type/?ug", "type/bug", true},
+		{"[", "[", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchLabel(tt.pattern, tt.label); got != tt.want {
+			t.Errorf("MatchLabel(%q, %q) = %v, want %v", tt.pattern, tt.label, got, tt.want)
+		}
+	}
+}
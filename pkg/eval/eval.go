@@ -0,0 +1,150 @@
+package eval
+
+import (
+	"slices"
+	"sort"
+)
+
+// Sample is the expected and predicted labels of one issue
+type Sample struct {
+	IssueID   int      `json:"issueId"`
+	Title     string   `json:"title"`
+	Expected  []string `json:"expected"`
+	Predicted []string `json:"predicted"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// LabelScore holds the counts and scores of a single label
+type LabelScore struct {
+	Label          string  `json:"label"`
+	TruePositives  int     `json:"truePositives"`
+	FalsePositives int     `json:"falsePositives"`
+	FalseNegatives int     `json:"falseNegatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+	F1             float64 `json:"f1"`
+}
+
+// Confusion counts how often Expected was missed while Predicted was wrongly
+// chosen on the same issue
+type Confusion struct {
+	Expected  string `json:"expected"`
+	Predicted string `json:"predicted"`
+	Count     int    `json:"count"`
+}
+
+type Report struct {
+	Issues int `json:"issues"`
+	// Failed is the number of issues the categorizer could not categorize.
+	// They are not included in the scores.
+	Failed     int     `json:"failed"`
+	ExactMatch float64 `json:"exactMatch"`
+	// Micro is the score computed over the counts of every label
+	Micro     LabelScore   `json:"micro"`
+	Labels    []LabelScore `json:"labels"`
+	Confusion []Confusion  `json:"confusion"`
+	Samples   []Sample     `json:"samples"`
+}
+
+// Evaluate computes the scores of the samples. Labels are sorted by name and
+// confusions by count so two reports can be diffed.
+func Evaluate(samples []Sample) Report {
+	report := Report{Issues: len(samples), Samples: samples}
+
+	scores := map[string]*LabelScore{}
+	score := func(label string) *LabelScore {
+		if _, ok := scores[label]; !ok {
+			scores[label] = &LabelScore{Label: label}
+		}
+		return scores[label]
+	}
+
+	confusions := map[[2]string]int{}
+	exact := 0
+
+	for _, sample := range samples {
+		if sample.Error != "" {
+			report.Failed++
+			continue
+		}
+
+		missed := []string{}
+		for _, label := range sample.Expected {
+			if slices.Contains(sample.Predicted, label) {
+				score(label).TruePositives++
+			} else {
+				score(label).FalseNegatives++
+				missed = append(missed, label)
+			}
+		}
+
+		wrong := []string{}
+		for _, label := range sample.Predicted {
+			if !slices.Contains(sample.Expected, label) {
+				score(label).FalsePositives++
+				wrong = append(wrong, label)
+			}
+		}
+
+		if len(missed) == 0 && len(wrong) == 0 {
+			exact++
+		}
+
+		for _, expected := range missed {
+			for _, predicted := range wrong {
+				confusions[[2]string{expected, predicted}]++
+			}
+		}
+	}
+
+	if evaluated := report.Issues - report.Failed; evaluated > 0 {
+		report.ExactMatch = float64(exact) / float64(evaluated)
+	}
+
+	report.Micro = LabelScore{Label: "micro"}
+	for _, s := range scores {
+		s.compute()
+		report.Labels = append(report.Labels, *s)
+		report.Micro.TruePositives += s.TruePositives
+		report.Micro.FalsePositives += s.FalsePositives
+		report.Micro.FalseNegatives += s.FalseNegatives
+	}
+	report.Micro.compute()
+
+	sort.Slice(report.Labels, func(i, j int) bool {
+		return report.Labels[i].Label < report.Labels[j].Label
+	})
+
+	for pair, count := range confusions {
+		report.Confusion = append(report.Confusion, Confusion{
+			Expected:  pair[0],
+			Predicted: pair[1],
+			Count:     count,
+		})
+	}
+
+	sort.Slice(report.Confusion, func(i, j int) bool {
+		a, b := report.Confusion[i], report.Confusion[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Expected != b.Expected {
+			return a.Expected < b.Expected
+		}
+		return a.Predicted < b.Predicted
+	})
+
+	return report
+}
+
+func (s *LabelScore) compute() {
+	if s.TruePositives+s.FalsePositives > 0 {
+		s.Precision = float64(s.TruePositives) / float64(s.TruePositives+s.FalsePositives)
+	}
+	if s.TruePositives+s.FalseNegatives > 0 {
+		s.Recall = float64(s.TruePositives) / float64(s.TruePositives+s.FalseNegatives)
+	}
+	if s.Precision+s.Recall > 0 {
+		s.F1 = 2 * s.Precision * s.Recall / (s.Precision + s.Recall)
+	}
+}
@@ -0,0 +1,52 @@
+package eval
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	samples := []Sample{
+		{IssueID: 1, Expected: []string{"area/alerting", "type/bug"}, Predicted: []string{"area/alerting", "type/bug"}},
+		{IssueID: 2, Expected: []string{"area/alerting", "type/bug"}, Predicted: []string{"area/explore", "type/bug"}},
+		{IssueID: 3, Expected: []string{"area/explore"}, Predicted: []string{"area/explore", "area/alerting"}},
+		{IssueID: 4, Expected: []string{"area/alerting"}, Error: "rate limited"},
+	}
+
+	report := Evaluate(samples)
+
+	if report.Issues != 4 || report.Failed != 1 {
+		t.Errorf("got %d issues and %d failed, want 4 and 1", report.Issues, report.Failed)
+	}
+	if want := 1.0 / 3; report.ExactMatch != want {
+		t.Errorf("ExactMatch = %v, want %v", report.ExactMatch, want)
+	}
+
+	wantLabels := []LabelScore{
+		{Label: "area/alerting", TruePositives: 1, FalsePositives: 1, FalseNegatives: 1, Precision: 0.5, Recall: 0.5, F1: 0.5},
+		{Label: "area/explore", TruePositives: 1, FalsePositives: 1, Precision: 0.5, Recall: 1, F1: 2.0 / 3},
+		{Label: "type/bug", TruePositives: 2, Precision: 1, Recall: 1, F1: 1},
+	}
+	if !reflect.DeepEqual(report.Labels, wantLabels) {
+		t.Errorf("Labels = %+v, want %+v", report.Labels, wantLabels)
+	}
+
+	wantMicro := LabelScore{Label: "micro", TruePositives: 4, FalsePositives: 2, FalseNegatives: 1, Precision: 4.0 / 6, Recall: 0.8}
+	wantMicro.F1 = 2 * wantMicro.Precision * wantMicro.Recall / (wantMicro.Precision + wantMicro.Recall)
+	if report.Micro != wantMicro {
+		t.Errorf("Micro = %+v, want %+v", report.Micro, wantMicro)
+	}
+
+	wantConfusion := []Confusion{{Expected: "area/alerting", Predicted: "area/explore", Count: 1}}
+	if !reflect.DeepEqual(report.Confusion, wantConfusion) {
+		t.Errorf("Confusion = %+v, want %+v", report.Confusion, wantConfusion)
+	}
+}
+
+func TestEvaluateNoSamples(t *testing.T) {
+	report := Evaluate(nil)
+
+	if report.ExactMatch != 0 || report.Micro.F1 != 0 || len(report.Labels) != 0 {
+		t.Errorf("got %+v, want an empty report", report)
+	}
+}
@@ -0,0 +1,235 @@
+package github
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/grafana/auto-triage/pkg/logme"
+)
+
+func GenerateJWT(appID int64, pemPath string) (string, error) {
+	privateKey, err := loadPEMKey(pemPath)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iat": now.Unix(),
+		"exp": now.Add(time.Minute * 10).Unix(),
+		"iss": appID,
+	})
+
+	return token.SignedString(privateKey)
+}
+
+// loadPEMKey loads and parses the PEM private key
+func loadPEMKey(pemPath string) (*rsa.PrivateKey, error) {
+	keyBytes, err := os.ReadFile(pemPath)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(keyBytes)
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		return nil, fmt.Errorf("failed to decode PEM block containing private key")
+	}
+
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// InstallationToken is a short lived token for an app installation
+type InstallationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// newAppRequest builds a request authenticated as the app itself (JWT)
+func (c *Client) newAppRequest(ctx context.Context, method string, url string, appID int64, pemPath string) (*http.Request, error) {
+	jwtToken, err := GenerateJWT(appID, pemPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+jwtToken)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", c.userAgent)
+
+	return req, nil
+}
+
+// GetInstallationToken exchanges the JWT for an installation token
+func (c *Client) GetInstallationToken(ctx context.Context, appID int64, pemPath string, installationID int64) (InstallationToken, error) {
+	req, err := c.newAppRequest(
+		ctx,
+		"POST",
+		fmt.Sprintf("/app/installations/%d/access_tokens", installationID),
+		appID,
+		pemPath,
+	)
+	if err != nil {
+		return InstallationToken{}, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return InstallationToken{}, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp, http.StatusCreated); err != nil {
+		return InstallationToken{}, fmt.Errorf("failed to generate installation token: %w", err)
+	}
+
+	var token InstallationToken
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return InstallationToken{}, err
+	}
+
+	return token, nil
+}
+
+// FindRepoInstallation returns the ID of the app installation that has access
+// to repo
+func (c *Client) FindRepoInstallation(ctx context.Context, appID int64, pemPath string, repo string) (int64, error) {
+	req, err := c.newAppRequest(ctx, "GET", fmt.Sprintf("/repos/%s/installation", repo), appID, pemPath)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return 0, fmt.Errorf("app %d is not installed on %s: %w", appID, repo, err)
+		}
+		return 0, err
+	}
+
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&installation)
+	if err != nil {
+		return 0, err
+	}
+
+	return installation.ID, nil
+}
+
+// GetAppSlug returns the slug of the app, which acts as <slug>[bot]
+func (c *Client) GetAppSlug(ctx context.Context, appID int64, pemPath string) (string, error) {
+	req, err := c.newAppRequest(ctx, "GET", "/app", appID, pemPath)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return "", err
+	}
+
+	var app struct {
+		Slug string `json:"slug"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&app)
+	if err != nil {
+		return "", err
+	}
+
+	return app.Slug, nil
+}
+
+// tokenRefreshMargin is how long before expiry an installation token is
+// renewed. Installation tokens are valid for one hour.
+const tokenRefreshMargin = 5 * time.Minute
+
+// AppTokenSource authenticates as a GitHub App installation. The installation
+// token is cached and renewed shortly before it expires, so it can be used in
+// long running processes.
+type AppTokenSource struct {
+	client         *Client
+	appID          int64
+	pemPath        string
+	installationID int64
+	repo           string
+
+	mu    sync.Mutex
+	token InstallationToken
+}
+
+// NewAppTokenSource creates a token source for the app installation. When
+// installationID is 0 the installation is looked up for repo on first use.
+// client is only used to call the app endpoints and does not need a token
+// source of its own.
+func NewAppTokenSource(client *Client, appID int64, pemPath string, installationID int64, repo string) *AppTokenSource {
+	return &AppTokenSource{
+		client:         client,
+		appID:          appID,
+		pemPath:        pemPath,
+		installationID: installationID,
+		repo:           repo,
+	}
+}
+
+func (s *AppTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token.Token != "" && time.Until(s.token.ExpiresAt) > tokenRefreshMargin {
+		return s.token.Token, nil
+	}
+
+	if s.installationID == 0 {
+		installationID, err := s.client.FindRepoInstallation(ctx, s.appID, s.pemPath, s.repo)
+		if err != nil {
+			return "", err
+		}
+		logme.DebugF("Found installation %d for %s\n", installationID, s.repo)
+		s.installationID = installationID
+	}
+
+	token, err := s.client.GetInstallationToken(ctx, s.appID, s.pemPath, s.installationID)
+	if err != nil {
+		return "", err
+	}
+
+	logme.DebugF("Renewed installation token, expires at %s\n", token.ExpiresAt)
+	s.token = token
+
+	return s.token.Token, nil
+}
+
+// Login returns the login of the app bot, the author of its changes
+func (s *AppTokenSource) Login(ctx context.Context) (string, error) {
+	slug, err := s.client.GetAppSlug(ctx, s.appID, s.pemPath)
+	if err != nil {
+		return "", err
+	}
+	return slug + "[bot]", nil
+}
@@ -0,0 +1,150 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBaseURL   = "https://api.github.com"
+	DefaultUserAgent = "grafana-auto-triage"
+)
+
+// TokenSource provides the token used to authenticate every request
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a TokenSource for a fixed token such as a personal access
+// token or the GITHUB_TOKEN of a workflow
+type StaticToken string
+
+func (t StaticToken) Token(context.Context) (string, error) {
+	return string(t), nil
+}
+
+type Config struct {
+	// BaseURL of the REST API. For GitHub Enterprise Server use
+	// https://<host>/api/v3
+	BaseURL string
+	// GraphQLURL defaults to <host>/api/graphql for GitHub Enterprise Server
+	// and to https://api.github.com/graphql otherwise
+	GraphQLURL string
+	// Tokens authenticates the requests. Requests are sent anonymously when
+	// nil.
+	Tokens     TokenSource
+	HTTPClient *http.Client
+	UserAgent  string
+	// MaxRateLimitWait is how long requests wait for a rate limit to reset
+	// before failing with a RateLimitError. Defaults to
+	// DefaultMaxRateLimitWait.
+	MaxRateLimitWait time.Duration
+}
+
+// Client talks to the GitHub REST and GraphQL APIs
+type Client struct {
+	baseURL    string
+	graphqlURL string
+	tokens     TokenSource
+	httpClient *http.Client
+	userAgent  string
+
+	// repoLabels caches the label names of every repository, see
+	// UnknownLabels
+	repoLabelsMu sync.Mutex
+	repoLabels   map[string]labelCache
+
+	// login caches the authenticated login, see Login
+	loginMu sync.Mutex
+	login   string
+}
+
+func NewClient(cfg Config) *Client {
+	baseURL := strings.TrimSuffix(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	graphqlURL := cfg.GraphQLURL
+	if graphqlURL == "" {
+		if strings.HasSuffix(baseURL, "/api/v3") {
+			graphqlURL = strings.TrimSuffix(baseURL, "/v3") + "/graphql"
+		} else {
+			graphqlURL = baseURL + "/graphql"
+		}
+	}
+
+	httpClient := &http.Client{}
+	if cfg.HTTPClient != nil {
+		// a copy, so the rate limits of GitHub don't affect other users of
+		// the client
+		*httpClient = *cfg.HTTPClient
+	}
+
+	maxWait := cfg.MaxRateLimitWait
+	if maxWait == 0 {
+		maxWait = DefaultMaxRateLimitWait
+	}
+	httpClient.Transport = NewRateLimitTransport(httpClient.Transport, maxWait)
+
+	userAgent := cfg.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+
+	return &Client{
+		baseURL:    baseURL,
+		graphqlURL: graphqlURL,
+		tokens:     cfg.Tokens,
+		httpClient: httpClient,
+		userAgent:  userAgent,
+		repoLabels: map[string]labelCache{},
+	}
+}
+
+// newRequest builds an authenticated request. url is either absolute or a
+// path relative to the REST API base URL. When payload is not nil it is
+// encoded as the JSON body.
+func (c *Client) newRequest(ctx context.Context, method string, url string, payload any) (*http.Request, error) {
+	if strings.HasPrefix(url, "/") {
+		url = c.baseURL + url
+	}
+
+	var body io.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewBuffer(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.tokens != nil {
+		token, err := c.tokens.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "token "+token)
+		}
+	}
+
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return req, nil
+}
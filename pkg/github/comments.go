@@ -0,0 +1,115 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grafana/auto-triage/pkg/logme"
+)
+
+type Comment struct {
+	ID        int64     `json:"id"`
+	NodeID    string    `json:"node_id"`
+	URL       string    `json:"url"`
+	HTMLURL   string    `json:"html_url"`
+	Body      string    `json:"body"`
+	User      User      `json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (c *Client) CreateIssueComment(ctx context.Context, repo string, issueId int, body string) (Comment, error) {
+	url := fmt.Sprintf("/repos/%s/issues/%d/comments", repo, issueId)
+
+	logme.DebugF("URL: %s\n", url)
+
+	req, err := c.newRequest(ctx, "POST", url, map[string]string{"body": body})
+	if err != nil {
+		return Comment{}, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return Comment{}, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp, http.StatusCreated); err != nil {
+		return Comment{}, err
+	}
+
+	var comment Comment
+	err = json.NewDecoder(resp.Body).Decode(&comment)
+	if err != nil {
+		return Comment{}, err
+	}
+
+	return comment, nil
+}
+
+// ListIssueComments returns all the comments of the issue, oldest first
+func (c *Client) ListIssueComments(ctx context.Context, repo string, issueId int) ([]Comment, error) {
+	return listAll[Comment](ctx, c, fmt.Sprintf("/repos/%s/issues/%d/comments", repo, issueId))
+}
+
+func (c *Client) UpdateIssueComment(ctx context.Context, repo string, commentId int64, body string) (Comment, error) {
+	url := fmt.Sprintf("/repos/%s/issues/comments/%d", repo, commentId)
+
+	logme.DebugF("URL: %s\n", url)
+
+	req, err := c.newRequest(ctx, "PATCH", url, map[string]string{"body": body})
+	if err != nil {
+		return Comment{}, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return Comment{}, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return Comment{}, err
+	}
+
+	var comment Comment
+	err = json.NewDecoder(resp.Body).Decode(&comment)
+	if err != nil {
+		return Comment{}, err
+	}
+
+	return comment, nil
+}
+
+// UpsertIssueComment creates a comment identified by marker, a hidden HTML
+// comment such as "<!-- my-bot -->", or updates it in place when the issue
+// already has one. Only the comments of the authenticated login that start
+// with the marker are updated, as anyone can paste the marker in a comment.
+func (c *Client) UpsertIssueComment(ctx context.Context, repo string, issueId int, marker string, body string) (Comment, error) {
+	body = marker + "\n" + body
+
+	login, err := c.Login(ctx)
+	if err != nil {
+		return Comment{}, err
+	}
+
+	comments, err := c.ListIssueComments(ctx, repo, issueId)
+	if err != nil {
+		return Comment{}, err
+	}
+
+	for _, comment := range comments {
+		if strings.HasPrefix(comment.Body, marker) && strings.EqualFold(comment.User.Login, login) {
+			if comment.Body == body {
+				return comment, nil
+			}
+			return c.UpdateIssueComment(ctx, repo, comment.ID, body)
+		}
+	}
+
+	return c.CreateIssueComment(ctx, repo, issueId, body)
+}
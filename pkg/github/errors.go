@@ -0,0 +1,159 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// The kinds of errors returned by the client. Check for them with errors.Is;
+// use errors.As with *APIError, *GraphQLError or *RateLimitError for the
+// details.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrValidation   = errors.New("validation failed")
+)
+
+// maxErrorBodyBytes caps how much of an error response is read
+const maxErrorBodyBytes = 1 << 20
+
+// APIError is an unexpected response of the REST API
+type APIError struct {
+	StatusCode int
+	Method     string
+	URL        string
+	// Message and Errors are read from the response body
+	Message          string
+	Errors           []FieldError
+	DocumentationURL string
+}
+
+// FieldError explains why a request was invalid, as listed in the errors of a
+// 422 response
+type FieldError struct {
+	Resource string `json:"resource"`
+	Field    string `json:"field"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+}
+
+// UnmarshalJSON accepts the plain strings some endpoints list as errors
+func (e *FieldError) UnmarshalJSON(data []byte) error {
+	var message string
+	if err := json.Unmarshal(data, &message); err == nil {
+		*e = FieldError{Message: message}
+		return nil
+	}
+
+	type fieldError FieldError
+	return json.Unmarshal(data, (*fieldError)(e))
+}
+
+func (e FieldError) String() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s.%s %s", e.Resource, e.Field, e.Code)
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("GitHub %s %s: %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if len(e.Errors) > 0 {
+		details := []string{}
+		for _, fieldErr := range e.Errors {
+			details = append(details, fieldErr.String())
+		}
+		msg += " (" + strings.Join(details, "; ") + ")"
+	}
+	return msg
+}
+
+// Is matches the ErrXxx error of the status code
+func (e *APIError) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		return target == ErrNotFound
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusTooManyRequests:
+		return target == ErrRateLimited
+	case http.StatusUnprocessableEntity:
+		return target == ErrValidation
+	}
+	return false
+}
+
+// Is matches ErrRateLimited
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// checkResponse returns an *APIError when the status code of the response is
+// not one of expected
+func checkResponse(resp *http.Response, expected ...int) error {
+	if slices.Contains(expected, resp.StatusCode) {
+		return nil
+	}
+
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	if resp.Request != nil {
+		apiErr.Method = resp.Request.Method
+		apiErr.URL = resp.Request.URL.Path
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	var payload struct {
+		Message          string       `json:"message"`
+		Errors           []FieldError `json:"errors"`
+		DocumentationURL string       `json:"documentation_url"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil {
+		apiErr.Message = payload.Message
+		apiErr.Errors = payload.Errors
+		apiErr.DocumentationURL = payload.DocumentationURL
+	} else {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+
+	return apiErr
+}
+
+// GraphQLError is an error listed in a GraphQL response
+type GraphQLError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+func (e *GraphQLError) Error() string {
+	if e.Type == "" {
+		return "GitHub GraphQL: " + e.Message
+	}
+	return fmt.Sprintf("GitHub GraphQL %s: %s", e.Type, e.Message)
+}
+
+// Is matches the ErrXxx error of the type
+func (e *GraphQLError) Is(target error) bool {
+	switch e.Type {
+	case "NOT_FOUND":
+		return target == ErrNotFound
+	case "FORBIDDEN", "INSUFFICIENT_SCOPES":
+		return target == ErrForbidden
+	case "RATE_LIMITED":
+		return target == ErrRateLimited
+	case "UNPROCESSABLE":
+		return target == ErrValidation
+	}
+	return false
+}
@@ -1,19 +1,16 @@
 package github
 
 import (
-	"bytes"
-	"crypto/rsa"
-	"crypto/x509"
+	"context"
 	"encoding/json"
-	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	neturl "net/url"
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/grafana/auto-triage/pkg/logme"
 )
 
@@ -47,11 +44,18 @@ type Issue struct {
 	StateReason           *string    `json:"state_reason"`
 }
 
+// Repo returns the owner/name of the repository the issue belongs to
+func (i Issue) Repo() string {
+	_, repo, _ := strings.Cut(i.RepositoryURL, "/repos/")
+	return repo
+}
+
 type Label struct {
-	ID    int    `json:"id"`
-	Name  string `json:"name"`
-	Color string `json:"color"`
-	Url   string `json:"url"`
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Url         string `json:"url"`
+	Description string `json:"description"`
 }
 
 type User struct {
@@ -89,13 +93,17 @@ type Reactions struct {
 }
 
 type GithubSearchIssueResult struct {
-	Items []Issue `json:"items"`
+	// TotalCount is the number of matches, of which the search API only
+	// returns the first 1000
+	TotalCount int     `json:"total_count"`
+	Items      []Issue `json:"items"`
 }
 
-func FetchIssueDetails(issueId int, repo string) (Issue, error) {
-	req, err := http.NewRequest(
+func (c *Client) FetchIssueDetails(ctx context.Context, issueId int, repo string) (Issue, error) {
+	req, err := c.newRequest(
+		ctx,
 		"GET",
-		fmt.Sprintf("https://api.github.com/repos/%s/issues/%d", repo, issueId),
+		fmt.Sprintf("/repos/%s/issues/%d", repo, issueId),
 		nil,
 	)
 
@@ -103,14 +111,15 @@ func FetchIssueDetails(issueId int, repo string) (Issue, error) {
 		return Issue{}, err
 	}
 
-	githubToken := os.Getenv("GH_TOKEN")
-
-	req.Header.Add("Authorization", fmt.Sprintf("token %s", githubToken))
-
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return Issue{}, err
 	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return Issue{}, err
+	}
 
 	issue := Issue{}
 	err = json.NewDecoder(resp.Body).Decode(&issue)
@@ -121,45 +130,35 @@ func FetchIssueDetails(issueId int, repo string) (Issue, error) {
 	return issue, nil
 }
 
-func FetchGrafanaIssueDetails(issueId int) (Issue, error) {
-	return FetchIssueDetails(issueId, "grafana/grafana")
+func (c *Client) FetchGrafanaIssueDetails(ctx context.Context, issueId int) (Issue, error) {
+	return c.FetchIssueDetails(ctx, issueId, "grafana/grafana")
 }
 
-func PublishIssueToRepo(repo string, issue Issue, labels []string) (Issue, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/issues", repo)
+func (c *Client) PublishIssueToRepo(ctx context.Context, repo string, issue Issue, labels []string) (Issue, error) {
+	url := fmt.Sprintf("/repos/%s/issues", repo)
 
-	payload, err := json.Marshal(map[string]interface{}{
+	payload := map[string]interface{}{
 		"title":  issue.Title,
 		"body":   issue.Body,
 		"labels": labels,
-	})
+	}
 
-	logme.DebugF("Payload: %s\n", payload)
+	logme.DebugF("Payload: %v\n", payload)
 	logme.DebugF("URL: %s\n", url)
 
+	req, err := c.newRequest(ctx, "POST", url, payload)
 	if err != nil {
 		return Issue{}, err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payload))
-	if err != nil {
-		return Issue{}, err
-	}
-
-	githubToken := os.Getenv("GH_TOKEN")
-
-	req.Header.Set("Authorization", "token "+githubToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return Issue{}, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		return Issue{}, fmt.Errorf("Error creating issue. Status code: %d", resp.StatusCode)
+	if err := checkResponse(resp, http.StatusCreated); err != nil {
+		return Issue{}, err
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -175,300 +174,178 @@ func PublishIssueToRepo(repo string, issue Issue, labels []string) (Issue, error
 	return createdIssue, nil
 }
 
-func AddLabelsToIssue(repo string, issueId int, labels []string) error {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/issues/%d/labels", repo, issueId)
+func (c *Client) AddLabelsToIssue(ctx context.Context, repo string, issueId int, labels []string) error {
+	url := fmt.Sprintf("/repos/%s/issues/%d/labels", repo, issueId)
 
-	payload, err := json.Marshal(map[string]interface{}{
+	payload := map[string]interface{}{
 		"labels": labels,
-	})
+	}
 
-	logme.DebugF("Payload: %s\n", payload)
+	logme.DebugF("Payload: %v\n", payload)
 	logme.DebugF("URL: %s\n", url)
 
+	req, err := c.newRequest(ctx, "POST", url, payload)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payload))
-	if err != nil {
-		return err
-	}
-
-	githubToken := os.Getenv("GH_TOKEN")
-
-	req.Header.Set("Authorization", "token "+githubToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Error creating issue. Status code: %d", resp.StatusCode)
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func GetIssuesByFilter(filter string, perPage int, page int) ([]Issue, error) {
-	var url = fmt.Sprintf("https://api.github.com/search/issues?q=%s&per_page=%d&page=%d", filter, perPage, page)
-	fmt.Printf("        --> URL: %s\n", url)
-	req, err := http.NewRequest("GET", url, nil)
+func (c *Client) GetIssuesByFilter(ctx context.Context, filter string, perPage int, page int) ([]Issue, error) {
+	result, err := c.SearchIssues(ctx, filter, perPage, page)
 	if err != nil {
 		return nil, err
 	}
 
-	githubToken := os.Getenv("GH_TOKEN")
+	return result.Items, nil
+}
 
-	fmt.Printf("URL: %s\n", req.URL.String())
+// SearchIssues returns a page of the issues matching filter, with the total
+// number of matches
+func (c *Client) SearchIssues(ctx context.Context, filter string, perPage int, page int) (GithubSearchIssueResult, error) {
+	var url = fmt.Sprintf(
+		"/search/issues?q=%s&per_page=%d&page=%d",
+		neturl.QueryEscape(filter),
+		perPage,
+		page,
+	)
+	logme.DebugF("URL: %s\n", url)
 
-	req.Header.Set("Authorization", "token "+githubToken)
+	req, err := c.newRequest(ctx, "GET", url, nil)
+	if err != nil {
+		return GithubSearchIssueResult{}, err
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return GithubSearchIssueResult{}, err
 	}
 	defer resp.Body.Close()
 
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return GithubSearchIssueResult{}, err
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return GithubSearchIssueResult{}, err
 	}
 
 	var issues GithubSearchIssueResult
 	err = json.Unmarshal(body, &issues)
 	if err != nil {
-		return nil, err
+		return GithubSearchIssueResult{}, err
 	}
 
-	return issues.Items, nil
+	return issues, nil
 }
 
-func AssignProjectToIssue(issueNodeId string, projecNodeId string) error {
-	query := fmt.Sprintf(`
-        mutation {
-            addProjectV2ItemById(input: {projectId: "%s", contentId: "%s"}) {
-                item {
-                    id
-                }
-            }
-        }`, projecNodeId, issueNodeId)
-
-	graphqlQuery := map[string]string{"query": query}
-	queryJson, err := json.Marshal(graphqlQuery)
+// graphql sends query to the GraphQL API and decodes the data of the response
+// into data. The errors of the response are returned as *GraphQLError.
+func (c *Client) graphql(ctx context.Context, query string, data any) error {
+	req, err := c.newRequest(ctx, "POST", c.graphqlURL, map[string]string{"query": query})
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest(
-		"POST",
-		"https://api.github.com/graphql",
-		bytes.NewBuffer(queryJson),
-	)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return err
 	}
-	githubToken := os.Getenv("GH_TOKEN")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "token "+githubToken)
+	defer resp.Body.Close()
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
+	if err := checkResponse(resp, http.StatusOK); err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return err
 	}
 
-	// dump body response
-	// fmt.Printf("assign Response body: %s\n", string(body))
-
-	// Parsing response
 	var result struct {
-		Data struct {
-			AddProjectV2ItemById struct {
-				Item struct {
-					ID string `json:"id"`
-				} `json:"item"`
-			} `json:"addProjectV2ItemById"`
-		} `json:"data"`
-		Errors []struct {
-			Type    string `json:"type"`
-			Message string `json:"message"`
-		}
+		Data   json.RawMessage `json:"data"`
+		Errors []GraphQLError  `json:"errors"`
 	}
-
 	err = json.Unmarshal(body, &result)
 	if err != nil {
 		return err
 	}
 
 	if len(result.Errors) > 0 {
-		return fmt.Errorf("error: %s", result.Errors[0].Message)
+		errs := []error{}
+		for i := range result.Errors {
+			errs = append(errs, &result.Errors[i])
+		}
+		return errors.Join(errs...)
+	}
+	if len(result.Data) == 0 {
+		return nil
 	}
 
-	return nil
+	return json.Unmarshal(result.Data, data)
 }
 
-func GetProjectNodeId(org string, projectId int) (string, error) {
+func (c *Client) AssignProjectToIssue(ctx context.Context, issueNodeId string, projecNodeId string) error {
 	query := fmt.Sprintf(`
-        {
-            organization(login: "%s") {
-                projectV2(number: %d) {
+        mutation {
+            addProjectV2ItemById(input: {projectId: "%s", contentId: "%s"}) {
+                item {
                     id
                 }
             }
-        }`, org, projectId)
-
-	graphqlQuery := map[string]string{"query": query}
-	queryJson, err := json.Marshal(graphqlQuery)
-	if err != nil {
-		return "", err
-	}
-
-	req, err := http.NewRequest(
-		"POST",
-		"https://api.github.com/graphql",
-		bytes.NewBuffer(queryJson),
-	)
-	if err != nil {
-		return "", err
-	}
-	githubToken := os.Getenv("GH_TOKEN")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "token "+githubToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	// dump body
-	// fmt.Printf("Response body: %s\n", string(body))
+        }`, projecNodeId, issueNodeId)
 
 	// Parsing response
-	var result struct {
-		Data struct {
-			Organization struct {
-				ProjectV2 struct {
-					ID string `json:"id"`
-				} `json:"projectV2"`
-			} `json:"organization"`
-		} `json:"data"`
-		Errors []struct {
-			Type    string `json:"type"`
-			Message string `json:"message"`
-		}
-	}
-
-	err = json.Unmarshal(body, &result)
-	if err != nil {
-		return "", err
-	}
-
-	if len(result.Errors) > 0 {
-		return "", fmt.Errorf("error: %s", result.Errors[0].Message)
-	}
-
-	if result.Data.Organization.ProjectV2.ID == "" {
-		return "", fmt.Errorf("project id is empty. Check if the project exists")
+	var data struct {
+		AddProjectV2ItemById struct {
+			Item struct {
+				ID string `json:"id"`
+			} `json:"item"`
+		} `json:"addProjectV2ItemById"`
 	}
 
-	return result.Data.Organization.ProjectV2.ID, nil
+	return c.graphql(ctx, query, &data)
 }
 
-func GenerateJWT(appID int64, pemPath string) (string, error) {
-	privateKey, err := loadPEMKey(pemPath)
-	if err != nil {
-		return "", err
-	}
-
-	now := time.Now().UTC()
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
-		"iat": now.Unix(),
-		"exp": now.Add(time.Minute * 10).Unix(),
-		"iss": appID,
-	})
-
-	return token.SignedString(privateKey)
-}
-
-// loadPEMKey loads and parses the PEM private key
-func loadPEMKey(pemPath string) (*rsa.PrivateKey, error) {
-	keyBytes, err := os.ReadFile(pemPath)
-	if err != nil {
-		return nil, err
-	}
-
-	block, _ := pem.Decode(keyBytes)
-	if block == nil || block.Type != "RSA PRIVATE KEY" {
-		return nil, fmt.Errorf("failed to decode PEM block containing private key")
-	}
-
-	return x509.ParsePKCS1PrivateKey(block.Bytes)
-}
-
-// GetInstallationToken exchanges the JWT for an installation token
-func GetInstallationToken(appID int64, pemPath string, installationID int64) (string, error) {
-	jwtToken, err := GenerateJWT(appID, pemPath)
-	if err != nil {
-		return "", err
-	}
+func (c *Client) GetProjectNodeId(ctx context.Context, org string, projectId int) (string, error) {
+	query := fmt.Sprintf(`
+        {
+            organization(login: "%s") {
+                projectV2(number: %d) {
+                    id
+                }
+            }
+        }`, org, projectId)
 
-	req, err := http.NewRequest(
-		"POST",
-		fmt.Sprintf("https://api.github.com/app/installations/%d/access_tokens", installationID),
-		nil,
-	)
-	if err != nil {
-		return "", err
+	// Parsing response
+	var data struct {
+		Organization struct {
+			ProjectV2 struct {
+				ID string `json:"id"`
+			} `json:"projectV2"`
+		} `json:"organization"`
 	}
 
-	req.Header.Set("Authorization", "Bearer "+jwtToken)
-	req.Header.Set("Accept", "application/vnd.github+json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	err := c.graphql(ctx, query, &data)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusCreated {
-		return "", fmt.Errorf("failed to generate installation token, status: %s", resp.Status)
-	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
+	if data.Organization.ProjectV2.ID == "" {
+		return "", fmt.Errorf("project %s/%d: %w", org, projectId, ErrNotFound)
 	}
 
-	return extractTokenFromBody(string(body)), nil
-}
-
-// extractTokenFromBody is a simple parser to extract the token from the response (expected as JSON)
-func extractTokenFromBody(body string) string {
-	// This is where you would parse the JSON body to get the token.
-	// For simplicity, use a proper JSON decoding function instead if needed.
-	if idx := strings.Index(body, `"token":`); idx != -1 {
-		start := idx + len(`"token":`) + 1
-		end := strings.Index(body[start:], `"`) + start
-		return body[start:end]
-	}
-	return ""
+	return data.Organization.ProjectV2.ID, nil
 }
@@ -0,0 +1,97 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/grafana/auto-triage/pkg/logme"
+)
+
+// ListRepoLabels returns all the labels of the repository
+func (c *Client) ListRepoLabels(ctx context.Context, repo string) ([]Label, error) {
+	return listAll[Label](ctx, c, fmt.Sprintf("/repos/%s/labels", repo))
+}
+
+const (
+	// repoLabelsTTL is how long the labels of a repository are cached
+	repoLabelsTTL = time.Hour
+	// repoLabelsRefresh is how old the cached labels must be to be fetched
+	// again when a label is missing from them, so labels created meanwhile
+	// are found without fetching the labels for every missing label
+	repoLabelsRefresh = time.Minute
+)
+
+// labelCache holds the label names of a repository, in lower case
+type labelCache struct {
+	names     map[string]bool
+	fetchedAt time.Time
+}
+
+// UnknownLabels returns the labels that don't exist in the repository. Like
+// on GitHub, names are compared ignoring case. The labels of each repository
+// are cached by the client for an hour, and fetched again when a label is
+// missing from them, in case it was created since.
+func (c *Client) UnknownLabels(ctx context.Context, repo string, labels []string) ([]string, error) {
+	c.repoLabelsMu.Lock()
+	defer c.repoLabelsMu.Unlock()
+
+	cached, ok := c.repoLabels[repo]
+	age := time.Since(cached.fetchedAt)
+	if !ok || age > repoLabelsTTL || (age > repoLabelsRefresh && len(missingLabels(cached, labels)) > 0) {
+		names, err := c.ListRepoLabels(ctx, repo)
+		if err != nil {
+			return nil, err
+		}
+
+		cached = labelCache{names: map[string]bool{}, fetchedAt: time.Now()}
+		for _, label := range names {
+			cached.names[strings.ToLower(label.Name)] = true
+		}
+		c.repoLabels[repo] = cached
+	}
+
+	return missingLabels(cached, labels), nil
+}
+
+// missingLabels returns the labels that are not in cached
+func missingLabels(cached labelCache, labels []string) []string {
+	missing := []string{}
+	for _, label := range labels {
+		if !cached.names[strings.ToLower(label)] {
+			missing = append(missing, label)
+		}
+	}
+	return missing
+}
+
+// RemoveLabelFromIssue removes the label from the issue. Removing a label the
+// issue doesn't have is not an error.
+func (c *Client) RemoveLabelFromIssue(ctx context.Context, repo string, issueId int, label string) error {
+	url := fmt.Sprintf("/repos/%s/issues/%d/labels/%s", repo, issueId, neturl.PathEscape(label))
+
+	logme.DebugF("URL: %s\n", url)
+
+	req, err := c.newRequest(ctx, "DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = checkResponse(resp, http.StatusOK)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound && apiErr.Message == "Label does not exist" {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,44 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// perPage is the page size of the list requests, the maximum of the REST API
+const perPage = 100
+
+// listAll fetches every page of the list endpoint at path, which has no query
+func listAll[T any](ctx context.Context, c *Client, path string) ([]T, error) {
+	items := []T{}
+	for page := 1; ; page++ {
+		req, err := c.newRequest(ctx, "GET", fmt.Sprintf("%s?per_page=%d&page=%d", path, perPage, page), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var pageItems []T
+		if err := checkResponse(resp, http.StatusOK); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		err = json.NewDecoder(resp.Body).Decode(&pageItems)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, pageItems...)
+
+		if len(pageItems) < perPage {
+			return items, nil
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/auto-triage/pkg/logme"
+)
+
+const (
+	// DefaultMaxRateLimitWait is how long requests wait for a rate limit to
+	// reset before failing with a RateLimitError
+	DefaultMaxRateLimitWait = 5 * time.Minute
+	// secondaryRateLimitWait is the wait after a secondary rate limit without
+	// Retry-After, as recommended by GitHub
+	secondaryRateLimitWait = time.Minute
+	// rateLimitRetries is the number of times a rate limited request is sent
+	// again after waiting
+	rateLimitRetries = 3
+)
+
+// RateLimitError is returned when GitHub rate limits a request and waiting for
+// the limit to reset would take longer than allowed. Check for it with
+// errors.As.
+type RateLimitError struct {
+	// Resource is the rate limit bucket, such as core, search or graphql
+	Resource string
+	Limit    int
+	// Reset is when the primary rate limit resets
+	Reset time.Time
+	// RetryAfter is the wait asked by a secondary rate limit
+	RetryAfter time.Duration
+	// Secondary is set for the secondary (abuse) rate limits, which apply
+	// even when requests remain in the primary limit
+	Secondary bool
+	Message   string
+}
+
+func (e *RateLimitError) Error() string {
+	if e.Secondary {
+		return fmt.Sprintf("GitHub secondary rate limit exceeded, retry after %s: %s", e.RetryAfter, e.Message)
+	}
+	return fmt.Sprintf("GitHub %s rate limit of %d requests exceeded, resets at %s", e.Resource, e.Limit, e.Reset.Format(time.RFC3339))
+}
+
+// Wait is how long until the request can be sent again
+func (e *RateLimitError) Wait(now time.Time) time.Duration {
+	if e.RetryAfter > 0 {
+		return e.RetryAfter
+	}
+	return max(e.Reset.Sub(now), 0)
+}
+
+// rateLimit is the last known state of a rate limit bucket
+type rateLimit struct {
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// RateLimitTransport tracks the rate limits reported by GitHub in the
+// response headers. Requests wait for an exhausted limit to reset, and rate
+// limited requests are sent again after the wait GitHub asks for. When the
+// wait is longer than MaxWait the request fails with a RateLimitError.
+type RateLimitTransport struct {
+	Base    http.RoundTripper
+	MaxWait time.Duration
+
+	mu     sync.Mutex
+	limits map[string]rateLimit
+}
+
+func NewRateLimitTransport(base http.RoundTripper, maxWait time.Duration) *RateLimitTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &RateLimitTransport{Base: base, MaxWait: maxWait, limits: map[string]rateLimit{}}
+}
+
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resource := rateLimitResource(req)
+
+	for attempt := 0; ; attempt++ {
+		if err := t.waitForReset(req, resource); err != nil {
+			return nil, err
+		}
+
+		resp, err := t.Base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		t.update(resp)
+
+		limitErr := rateLimitError(resp, resource)
+		if limitErr == nil {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		wait := limitErr.Wait(time.Now())
+		if attempt >= rateLimitRetries || wait > t.MaxWait || (req.Body != nil && req.GetBody == nil) {
+			return nil, limitErr
+		}
+
+		logme.InfoF("%v. Waiting %s\n", limitErr, wait.Round(time.Second))
+		if err := sleep(req, wait); err != nil {
+			return nil, err
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// waitForReset waits when the last response said the limit of the resource is
+// exhausted
+func (t *RateLimitTransport) waitForReset(req *http.Request, resource string) error {
+	t.mu.Lock()
+	limit, ok := t.limits[resource]
+	t.mu.Unlock()
+
+	if !ok || limit.remaining > 0 {
+		return nil
+	}
+
+	wait := time.Until(limit.reset)
+	if wait <= 0 {
+		return nil
+	}
+
+	if wait > t.MaxWait {
+		return &RateLimitError{Resource: resource, Limit: limit.limit, Reset: limit.reset}
+	}
+
+	logme.InfoF("GitHub %s rate limit exhausted. Waiting %s for it to reset\n", resource, wait.Round(time.Second))
+	return sleep(req, wait)
+}
+
+// update records the rate limit headers of the response
+func (t *RateLimitTransport) update(resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	limit, _ := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	reset, _ := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+
+	resource := resp.Header.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = rateLimitResource(resp.Request)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.limits[resource] = rateLimit{limit: limit, remaining: remaining, reset: time.Unix(reset, 0)}
+
+	if limit > 0 && remaining < limit/10 {
+		logme.DebugF("GitHub %s rate limit: %d of %d requests left\n", resource, remaining, limit)
+	}
+}
+
+// rateLimitError returns the error when the response is a rate limit, and nil
+// otherwise. The body of other 403 responses is left readable.
+func rateLimitError(resp *http.Response, resource string) *RateLimitError {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	message := string(body)
+	var payload struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil && payload.Message != "" {
+		message = payload.Message
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		limit, _ := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+		reset, _ := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+		return &RateLimitError{Resource: resource, Limit: limit, Reset: time.Unix(reset, 0), Message: message}
+	}
+
+	if header := resp.Header.Get("Retry-After"); header != "" {
+		seconds, err := strconv.Atoi(header)
+		if err == nil {
+			return &RateLimitError{Resource: resource, RetryAfter: time.Duration(seconds) * time.Second, Secondary: true, Message: message}
+		}
+	}
+
+	if strings.Contains(strings.ToLower(message), "secondary rate limit") {
+		return &RateLimitError{Resource: resource, RetryAfter: secondaryRateLimitWait, Secondary: true, Message: message}
+	}
+
+	return nil
+}
+
+// rateLimitResource guesses the rate limit bucket of the request, used until
+// GitHub reports it in X-RateLimit-Resource
+func rateLimitResource(req *http.Request) string {
+	switch {
+	case req == nil:
+		return "core"
+	case strings.HasSuffix(req.URL.Path, "/graphql"):
+		return "graphql"
+	case strings.Contains(req.URL.Path, "/search/"):
+		return "search"
+	default:
+		return "core"
+	}
+}
+
+// sleep waits for d or until the request is canceled
+func sleep(req *http.Request, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,104 @@
+package github
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimitTransportRetriesSecondaryLimit(t *testing.T) {
+	bodies := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"message":"You have exceeded a secondary rate limit"}`)
+			return
+		}
+		io.WriteString(w, `{}`)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewRateLimitTransport(nil, time.Minute)}
+	req, err := http.NewRequest("POST", server.URL+"/repos/o/r/issues/1/labels", strings.NewReader(`{"labels":["type/bug"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d, want 200", resp.StatusCode)
+	}
+	if len(bodies) != 2 || bodies[1] != bodies[0] {
+		t.Errorf("got request bodies %q, want the same body sent twice", bodies)
+	}
+}
+
+func TestRateLimitTransportFailsLongWaits(t *testing.T) {
+	reset := time.Now().Add(time.Hour)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		w.Header().Set("X-RateLimit-Resource", "core")
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"message":"API rate limit exceeded"}`)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewRateLimitTransport(nil, time.Minute)}
+
+	for range 2 {
+		_, err := client.Get(server.URL + "/repos/o/r/issues/1")
+
+		var limitErr *RateLimitError
+		if !errors.As(err, &limitErr) || !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("got error %v, want a RateLimitError", err)
+		}
+		if limitErr.Resource != "core" || limitErr.Limit != 5000 || limitErr.Reset.Unix() != reset.Unix() {
+			t.Errorf("got %+v, want the core limit resetting at %s", limitErr, reset)
+		}
+	}
+
+	// the second request fails without being sent, the limit is known
+	if requests != 1 {
+		t.Errorf("got %d requests, want 1", requests)
+	}
+}
+
+func TestRateLimitTransportKeepsForbiddenBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"message":"Resource not accessible by integration"}`)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewRateLimitTransport(nil, time.Minute)}
+	resp, err := client.Get(server.URL + "/repos/o/r/issues/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(string(body), "Resource not accessible by integration") {
+		t.Errorf("got %d %q, want the forbidden response", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,34 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TimelineEvent is an event of the issue timeline. Only the fields used by the
+// triager are decoded; which ones are set depends on Event.
+type TimelineEvent struct {
+	Event     string    `json:"event"`
+	Actor     *User     `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+	// Body is set for "commented" events
+	Body string `json:"body"`
+	// Label is set for "labeled" and "unlabeled" events
+	Label *Label `json:"label"`
+	// Rename is set for "renamed" events
+	Rename *struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	} `json:"rename"`
+	// Source is set for "cross-referenced" events
+	Source *struct {
+		Type  string `json:"type"`
+		Issue *Issue `json:"issue"`
+	} `json:"source"`
+}
+
+// ListIssueTimeline returns all the timeline events of the issue, oldest first
+func (c *Client) ListIssueTimeline(ctx context.Context, repo string, issueId int) ([]TimelineEvent, error) {
+	return listAll[TimelineEvent](ctx, c, fmt.Sprintf("/repos/%s/issues/%d/timeline", repo, issueId))
+}
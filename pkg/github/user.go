@@ -0,0 +1,74 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// actionsBotLogin is the author of the changes made with the GITHUB_TOKEN of a
+// workflow
+const actionsBotLogin = "github-actions[bot]"
+
+// loginSource is implemented by the token sources that know the login they
+// authenticate as, such as AppTokenSource
+type loginSource interface {
+	Login(ctx context.Context) (string, error)
+}
+
+// Login returns the login of the authenticated user or bot, the author of the
+// comments and labels added by the client. It is fetched once and cached.
+func (c *Client) Login(ctx context.Context) (string, error) {
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+
+	if c.login != "" {
+		return c.login, nil
+	}
+
+	var login string
+	var err error
+	if source, ok := c.tokens.(loginSource); ok {
+		login, err = source.Login(ctx)
+	} else {
+		login, err = c.fetchUserLogin(ctx)
+		// installation tokens can't read /user. The only one used as a
+		// static token is the GITHUB_TOKEN of a workflow.
+		if errors.Is(err, ErrForbidden) {
+			login, err = actionsBotLogin, nil
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	c.login = login
+	return login, nil
+}
+
+// fetchUserLogin returns the login of the user of the token
+func (c *Client) fetchUserLogin(ctx context.Context) (string, error) {
+	req, err := c.newRequest(ctx, "GET", "/user", nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return "", err
+	}
+
+	var user User
+	err = json.NewDecoder(resp.Body).Decode(&user)
+	if err != nil {
+		return "", err
+	}
+
+	return user.Login, nil
+}
@@ -0,0 +1,162 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultAnthropicURL = "https://api.anthropic.com/v1"
+	anthropicVersion    = "2023-06-01"
+	anthropicMaxTokens  = 4096
+)
+
+// anthropicProvider uses the Messages API. Structured output is obtained by
+// forcing the model to call a single tool whose input schema is the result
+// schema.
+type anthropicProvider struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+func newAnthropicProvider(cfg Config) *anthropicProvider {
+	baseURL := defaultAnthropicURL
+	if cfg.BaseURL != "" {
+		baseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	}
+
+	return &anthropicProvider{
+		apiKey:  cfg.APIKey,
+		baseURL: baseURL,
+		client:  cfg.httpClient(),
+	}
+}
+
+type anthropicTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	InputSchema any    `json:"input_schema"`
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model      string             `json:"model"`
+	MaxTokens  int                `json:"max_tokens"`
+	System     string             `json:"system"`
+	Messages   []anthropicMessage `json:"messages"`
+	Tools      []anthropicTool    `json:"tools"`
+	ToolChoice map[string]string  `json:"tool_choice"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+	Usage struct {
+		InputTokens              int `json:"input_tokens"`
+		OutputTokens             int `json:"output_tokens"`
+		CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+		CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *anthropicProvider) Complete(ctx context.Context, req Request) (Response, error) {
+	payload, err := json.Marshal(anthropicRequest{
+		Model:     req.Model,
+		MaxTokens: anthropicMaxTokens,
+		System:    req.System,
+		Messages: []anthropicMessage{
+			{Role: "user", Content: req.User},
+		},
+		Tools: []anthropicTool{
+			{
+				Name:        req.SchemaName,
+				Description: "Report the result of the analysis",
+				InputSchema: req.Schema,
+			},
+		},
+		ToolChoice: map[string]string{"type": "tool", "name": req.SchemaName},
+	})
+	if err != nil {
+		return Response{}, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		p.baseURL+"/messages",
+		bytes.NewBuffer(payload),
+	)
+	if err != nil {
+		return Response{}, err
+	}
+
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Response{}, err
+	}
+
+	var result anthropicResponse
+	decodeErr := json.Unmarshal(body, &result)
+
+	if resp.StatusCode != http.StatusOK {
+		providerErr := &Error{
+			Provider:   ProviderAnthropic,
+			StatusCode: resp.StatusCode,
+			Message:    truncate(string(body), 200),
+			RetryAfter: retryAfter(resp.StatusCode, resp.Header),
+		}
+		if decodeErr == nil && result.Error != nil {
+			providerErr.Code = result.Error.Type
+			providerErr.Message = result.Error.Message
+		}
+		return Response{}, providerErr
+	}
+
+	if decodeErr != nil {
+		return Response{}, fmt.Errorf("error decoding anthropic response: %w", decodeErr)
+	}
+
+	// input_tokens excludes the cached tokens, unlike the OpenAI prompt_tokens
+	usage := Usage{
+		PromptTokens: result.Usage.InputTokens +
+			result.Usage.CacheCreationInputTokens +
+			result.Usage.CacheReadInputTokens,
+		CompletionTokens: result.Usage.OutputTokens,
+		CachedTokens:     result.Usage.CacheReadInputTokens,
+	}
+
+	for _, content := range result.Content {
+		if content.Type == "tool_use" {
+			return Response{Content: string(content.Input), Usage: usage}, nil
+		}
+	}
+
+	return Response{Usage: usage}, fmt.Errorf("model did not return a %s tool call", req.SchemaName)
+}
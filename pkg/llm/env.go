@@ -0,0 +1,33 @@
+package llm
+
+import "os"
+
+// APIKeyEnvs maps each provider to the env var holding its API key
+var APIKeyEnvs = map[string]string{
+	ProviderOpenAI:    "OPENAI_API_KEY",
+	ProviderAzure:     "AZURE_OPENAI_API_KEY",
+	ProviderAnthropic: "ANTHROPIC_API_KEY",
+	ProviderOllama:    "OLLAMA_API_KEY",
+}
+
+// ConfigFromEnv reads the key and endpoint settings of provider from the
+// environment
+func ConfigFromEnv(provider string) Config {
+	cfg := Config{
+		Provider: provider,
+		APIKey:   os.Getenv(APIKeyEnvs[provider]),
+	}
+
+	switch provider {
+	case ProviderOpenAI:
+		cfg.BaseURL = os.Getenv("OPENAI_BASE_URL")
+		cfg.Organization = os.Getenv("OPENAI_ORG_ID")
+	case ProviderAzure:
+		cfg.BaseURL = os.Getenv("AZURE_OPENAI_ENDPOINT")
+		cfg.APIVersion = os.Getenv("AZURE_OPENAI_API_VERSION")
+	case ProviderOllama:
+		cfg.BaseURL = os.Getenv("OLLAMA_BASE_URL")
+	}
+
+	return cfg
+}
@@ -0,0 +1,132 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Error is an error response of the provider
+type Error struct {
+	Provider   string
+	StatusCode int
+	// Code is the error code or type of the provider, such as
+	// context_length_exceeded or overloaded_error
+	Code    string
+	Message string
+	// RetryAfter is the wait asked by the provider in the rate limit headers
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s error (status %d)", e.Provider, e.StatusCode)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %s)", e.RetryAfter)
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// openAIError converts the errors of the go-openai client, adding the wait
+// asked by the rate limit headers of the response
+func openAIError(provider string, err error, header http.Header) error {
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+
+	providerErr := &Error{Provider: provider, Err: err}
+	switch {
+	case errors.As(err, &apiErr):
+		providerErr.StatusCode = apiErr.HTTPStatusCode
+		providerErr.Message = apiErr.Message
+		// the code is a string, or a number or null for some errors
+		if code, ok := apiErr.Code.(string); ok && code != "" {
+			providerErr.Code = code
+		} else {
+			providerErr.Code = apiErr.Type
+		}
+	case errors.As(err, &reqErr):
+		providerErr.StatusCode = reqErr.HTTPStatusCode
+		providerErr.Message = truncate(string(reqErr.Body), 200)
+	default:
+		// no response, such as a timeout
+		return err
+	}
+	providerErr.RetryAfter = retryAfter(providerErr.StatusCode, header)
+
+	return providerErr
+}
+
+// retryAfter returns the wait asked by the headers of an error response:
+// retry-after-ms or retry-after and, for rate limited requests, the longest
+// of the OpenAI x-ratelimit-reset-* durations or the Anthropic
+// anthropic-ratelimit-*-reset times. It returns 0 when there is none.
+func retryAfter(statusCode int, header http.Header) time.Duration {
+	if header == nil {
+		return 0
+	}
+
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if at, err := http.ParseTime(value); err == nil {
+			return max(time.Until(at), 0)
+		}
+	}
+
+	if statusCode != http.StatusTooManyRequests {
+		return 0
+	}
+
+	// the reset of the exhausted limits, or of all of them when the headers
+	// don't tell which one is
+	wait, exhaustedWait := time.Duration(0), time.Duration(0)
+	for _, limit := range []string{"requests", "tokens"} {
+		var reset time.Duration
+		var ok bool
+		exhausted := header.Get("X-Ratelimit-Remaining-"+limit) == "0" || header.Get("Anthropic-Ratelimit-"+limit+"-Remaining") == "0"
+
+		if d, err := time.ParseDuration(header.Get("X-Ratelimit-Reset-" + limit)); err == nil {
+			reset, ok = d, true
+		} else if at, err := time.Parse(time.RFC3339, header.Get("Anthropic-Ratelimit-"+limit+"-Reset")); err == nil {
+			reset, ok = max(time.Until(at), 0), true
+		}
+		if !ok {
+			continue
+		}
+
+		wait = max(wait, reset)
+		if exhausted {
+			exhaustedWait = max(exhaustedWait, reset)
+		}
+	}
+
+	if exhaustedWait > 0 {
+		return exhaustedWait
+	}
+	return wait
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,76 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAzure     = "azure"
+	ProviderAnthropic = "anthropic"
+	ProviderOllama    = "ollama"
+)
+
+// Providers lists the provider names accepted by NewProvider
+var Providers = []string{ProviderOpenAI, ProviderAzure, ProviderAnthropic, ProviderOllama}
+
+// Provider sends a single structured completion request to an LLM backend
+type Provider interface {
+	Complete(ctx context.Context, req Request) (Response, error)
+}
+
+// Request is a provider agnostic completion request. The model is expected to
+// answer with a JSON document matching Schema.
+type Request struct {
+	Model      string
+	System     string
+	User       string
+	SchemaName string
+	Schema     *jsonschema.Definition
+}
+
+// Response holds the raw JSON document returned by the model
+type Response struct {
+	Content string
+	Usage   Usage
+}
+
+type Config struct {
+	Provider string
+	APIKey   string
+	// BaseURL overrides the default endpoint of the provider. It is required
+	// for azure (the resource endpoint).
+	BaseURL string
+	// APIVersion is only used by the azure provider. It must support
+	// structured outputs, and defaults to 2024-10-21.
+	APIVersion string
+	// Organization is sent as the OpenAI-Organization header by the openai
+	// provider
+	Organization string
+	// Headers are added to every request sent to the provider
+	Headers http.Header
+	// HTTPClient defaults to a plain http.Client
+	HTTPClient *http.Client
+}
+
+func NewProvider(cfg Config) (Provider, error) {
+	switch cfg.Provider {
+	case ProviderOpenAI, "":
+		return newOpenAIProvider(cfg), nil
+	case ProviderAzure:
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("azure provider requires an endpoint")
+		}
+		return newOpenAIProvider(cfg), nil
+	case ProviderOllama:
+		return newOpenAIProvider(cfg), nil
+	case ProviderAnthropic:
+		return newAnthropicProvider(cfg), nil
+	}
+
+	return nil, fmt.Errorf("unknown provider %q", cfg.Provider)
+}
@@ -0,0 +1,108 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	defaultOllamaURL = "http://localhost:11434/v1"
+	// defaultAzureAPIVersion is the first GA version of Azure OpenAI with
+	// structured outputs (json_schema response format). The version of
+	// go-openai, 2023-05-15, rejects every request of the categorizer.
+	defaultAzureAPIVersion = "2024-10-21"
+)
+
+// openAIProvider talks to OpenAI and any OpenAI compatible API (Azure OpenAI,
+// Ollama, llama.cpp server)
+type openAIProvider struct {
+	name   string
+	client *openai.Client
+}
+
+func newOpenAIProvider(cfg Config) *openAIProvider {
+	var config openai.ClientConfig
+
+	switch cfg.Provider {
+	case ProviderAzure:
+		config = openai.DefaultAzureConfig(cfg.APIKey, cfg.BaseURL)
+		config.APIVersion = defaultAzureAPIVersion
+		if cfg.APIVersion != "" {
+			config.APIVersion = cfg.APIVersion
+		}
+	case ProviderOllama:
+		// ollama ignores the key but the client always sends one
+		apiKey := cfg.APIKey
+		if apiKey == "" {
+			apiKey = ProviderOllama
+		}
+		config = openai.DefaultConfig(apiKey)
+		config.BaseURL = defaultOllamaURL
+		if cfg.BaseURL != "" {
+			config.BaseURL = cfg.BaseURL
+		}
+	default:
+		config = openai.DefaultConfig(cfg.APIKey)
+		config.OrgID = cfg.Organization
+		if cfg.BaseURL != "" {
+			config.BaseURL = cfg.BaseURL
+		}
+	}
+
+	config.HTTPClient = recordResponseHeaders(cfg.httpClient())
+
+	name := cfg.Provider
+	if name == "" {
+		name = ProviderOpenAI
+	}
+
+	return &openAIProvider{name: name, client: openai.NewClientWithConfig(config)}
+}
+
+func (p *openAIProvider) Complete(ctx context.Context, req Request) (Response, error) {
+	var header http.Header
+	resp, err := p.client.CreateChatCompletion(
+		withResponseHeader(ctx, &header),
+		openai.ChatCompletionRequest{
+			Model: req.Model,
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role:    openai.ChatMessageRoleSystem,
+					Content: req.System,
+				},
+				{
+					Role:    openai.ChatMessageRoleUser,
+					Content: req.User,
+				},
+			},
+			ResponseFormat: &openai.ChatCompletionResponseFormat{
+				Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+				JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+					Name:   req.SchemaName,
+					Schema: req.Schema,
+					Strict: true,
+				},
+			},
+		},
+	)
+	if err != nil {
+		return Response{}, openAIError(p.name, err, header)
+	}
+
+	usage := Usage{
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	}
+	if resp.Usage.PromptTokensDetails != nil {
+		usage.CachedTokens = resp.Usage.PromptTokensDetails.CachedTokens
+	}
+
+	if len(resp.Choices) == 0 {
+		return Response{Usage: usage}, fmt.Errorf("model returned no choices")
+	}
+
+	return Response{Content: resp.Choices[0].Message.Content, Usage: usage}, nil
+}
@@ -0,0 +1,89 @@
+package llm
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"strings"
+)
+
+// Usage is the token usage reported by the provider for a request
+type Usage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	// CachedTokens is the part of PromptTokens served from the prompt cache
+	CachedTokens int `json:"cachedTokens"`
+}
+
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.CachedTokens += other.CachedTokens
+}
+
+// Price of a model in USD per million tokens
+type Price struct {
+	Input       float64 `json:"input"`
+	CachedInput float64 `json:"cachedInput"`
+	Output      float64 `json:"output"`
+}
+
+// Cost returns the cost in USD of usage
+func (p Price) Cost(usage Usage) float64 {
+	uncached := usage.PromptTokens - usage.CachedTokens
+	return (float64(uncached)*p.Input +
+		float64(usage.CachedTokens)*p.CachedInput +
+		float64(usage.CompletionTokens)*p.Output) / 1_000_000
+}
+
+// Prices maps model name prefixes to their price. The longest matching prefix
+// wins.
+type Prices map[string]Price
+
+// DefaultPrices are the list prices of common OpenAI models at the time of
+// writing. Override them with LoadPrices when they change or for other
+// providers.
+var DefaultPrices = Prices{
+	"gpt-5":        {Input: 1.25, CachedInput: 0.125, Output: 10},
+	"gpt-5-mini":   {Input: 0.25, CachedInput: 0.025, Output: 2},
+	"gpt-5-nano":   {Input: 0.05, CachedInput: 0.005, Output: 0.4},
+	"gpt-4.1":      {Input: 2, CachedInput: 0.5, Output: 8},
+	"gpt-4.1-mini": {Input: 0.4, CachedInput: 0.1, Output: 1.6},
+	"gpt-4.1-nano": {Input: 0.1, CachedInput: 0.025, Output: 0.4},
+	"gpt-4o":       {Input: 2.5, CachedInput: 1.25, Output: 10},
+	"gpt-4o-mini":  {Input: 0.15, CachedInput: 0.075, Output: 0.6},
+}
+
+// LoadPrices reads a JSON file mapping model prefixes to prices and merges it
+// over DefaultPrices
+func LoadPrices(path string) (Prices, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var custom Prices
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, err
+	}
+
+	prices := maps.Clone(DefaultPrices)
+	maps.Copy(prices, custom)
+
+	return prices, nil
+}
+
+// ForModel returns the price of model
+func (p Prices) ForModel(model string) (Price, bool) {
+	price := Price{}
+	longest := -1
+
+	for prefix, candidate := range p {
+		if strings.HasPrefix(model, prefix) && len(prefix) > longest {
+			price = candidate
+			longest = len(prefix)
+		}
+	}
+
+	return price, longest >= 0
+}
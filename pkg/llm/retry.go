@@ -0,0 +1,98 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/grafana/auto-triage/pkg/logme"
+	"github.com/grafana/auto-triage/pkg/retry"
+)
+
+// DefaultRetryPolicy makes 5 attempts, waiting from 1 second up to a minute
+var DefaultRetryPolicy = RetryPolicy{Attempts: 5, BaseDelay: time.Second, MaxDelay: time.Minute}
+
+// RetryPolicy sends a request again when it fails with a retryable error,
+// after the backoff of the retry.Policy unless the provider asks for a longer
+// wait in its rate limit headers. A request the provider asks to wait longer
+// than MaxDelay for fails right away.
+type RetryPolicy retry.Policy
+
+// Do calls fn until it succeeds, fails with an error that is not retryable or
+// has been called Attempts times, and returns its last error
+func (p RetryPolicy) Do(ctx context.Context, fn func(attempt int) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= p.Attempts || !Retryable(err) {
+			return err
+		}
+
+		wait, ok := p.Delay(attempt, err)
+		if !ok {
+			return err
+		}
+
+		logme.ErrorF("%v\n", err)
+		logme.InfoF("Retrying in %s. %d attempts left\n", wait.Round(time.Millisecond), p.Attempts-attempt)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// Delay returns the wait after the failed attempt, the backoff or the wait
+// asked by the provider, and false when the provider asks to wait longer than
+// MaxDelay
+func (p RetryPolicy) Delay(attempt int, err error) (time.Duration, bool) {
+	delay := retry.Policy(p).Backoff(attempt)
+
+	var providerErr *Error
+	if errors.As(err, &providerErr) && providerErr.RetryAfter > delay {
+		if providerErr.RetryAfter > p.MaxDelay {
+			return providerErr.RetryAfter, false
+		}
+		delay = providerErr.RetryAfter
+	}
+
+	return delay, true
+}
+
+// Retryable reports whether sending the request again may succeed. Rate
+// limits, server errors, timeouts and invalid answers of the model are
+// retryable. Invalid requests, such as a prompt over the context length of
+// the model, authentication errors and an exhausted quota are not, nor is a
+// canceled context.
+func Retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var providerErr *Error
+	if errors.As(err, &providerErr) {
+		switch {
+		case providerErr.Code == "insufficient_quota":
+			return false
+		case providerErr.StatusCode == http.StatusRequestTimeout,
+			providerErr.StatusCode == http.StatusConflict,
+			providerErr.StatusCode == http.StatusTooManyRequests,
+			providerErr.StatusCode >= 500:
+			return true
+		case providerErr.StatusCode >= 400:
+			return false
+		}
+		return true
+	}
+
+	// errors without a response, such as timeouts, and invalid answers
+	return true
+}
@@ -0,0 +1,121 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{Attempts: 5, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	overloaded := &Error{Provider: "openai", StatusCode: http.StatusInternalServerError}
+
+	tests := []struct {
+		name     string
+		attempt  int
+		err      error
+		min, max time.Duration
+		wantOK   bool
+	}{
+		{"first attempt", 1, overloaded, 500 * time.Millisecond, time.Second, true},
+		{"doubles", 3, overloaded, 2 * time.Second, 4 * time.Second, true},
+		{"capped", 10, overloaded, 5 * time.Second, 10 * time.Second, true},
+		{
+			name:    "retry after",
+			attempt: 1,
+			err:     &Error{Provider: "openai", StatusCode: http.StatusTooManyRequests, RetryAfter: 7 * time.Second},
+			min:     7 * time.Second,
+			max:     7 * time.Second,
+			wantOK:  true,
+		},
+		{
+			name:    "shorter retry after",
+			attempt: 3,
+			err:     fmt.Errorf("error categorizing: %w", &Error{Provider: "openai", StatusCode: http.StatusTooManyRequests, RetryAfter: time.Millisecond}),
+			min:     2 * time.Second,
+			max:     4 * time.Second,
+			wantOK:  true,
+		},
+		{
+			name:    "retry after over MaxDelay",
+			attempt: 1,
+			err:     &Error{Provider: "openai", StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour},
+			min:     time.Hour,
+			max:     time.Hour,
+			wantOK:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the jitter is random, check the bounds a few times
+			for range 20 {
+				delay, ok := policy.Delay(tt.attempt, tt.err)
+				if ok != tt.wantOK || delay < tt.min || delay > tt.max {
+					t.Fatalf("Delay() = %s, %v, want between %s and %s, %v", delay, ok, tt.min, tt.max, tt.wantOK)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&Error{StatusCode: http.StatusTooManyRequests, Code: "rate_limit_exceeded"}, true},
+		{&Error{StatusCode: http.StatusTooManyRequests, Code: "insufficient_quota"}, false},
+		{&Error{StatusCode: http.StatusServiceUnavailable}, true},
+		{&Error{StatusCode: 529, Code: "overloaded_error"}, true},
+		{&Error{StatusCode: http.StatusBadRequest, Code: "context_length_exceeded"}, false},
+		{&Error{StatusCode: http.StatusUnauthorized}, false},
+		{context.DeadlineExceeded, true},
+		{fmt.Errorf("request: %w", context.Canceled), false},
+		{errors.New("invalid JSON answer"), true},
+	}
+
+	for _, tt := range tests {
+		if got := Retryable(tt.err); got != tt.want {
+			t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	calls := 0
+	err := policy.Do(context.Background(), func(attempt int) error {
+		calls++
+		if attempt < 2 {
+			return &Error{StatusCode: http.StatusBadGateway}
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("Do() = %v after %d calls, want success after 2", err, calls)
+	}
+
+	calls = 0
+	invalid := &Error{StatusCode: http.StatusBadRequest}
+	err = policy.Do(context.Background(), func(int) error {
+		calls++
+		return invalid
+	})
+	if !errors.Is(err, invalid) || calls != 1 {
+		t.Errorf("Do() = %v after %d calls, want the invalid request error after 1", err, calls)
+	}
+
+	calls = 0
+	err = policy.Do(context.Background(), func(int) error {
+		calls++
+		return &Error{StatusCode: http.StatusBadGateway}
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("Do() = %v after %d calls, want an error after 3", err, calls)
+	}
+}
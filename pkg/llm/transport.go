@@ -0,0 +1,91 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+)
+
+// headerTransport adds a fixed set of headers to every outgoing request. It is
+// used to pass gateway credentials or routing headers to proxies in front of
+// the provider.
+type headerTransport struct {
+	headers http.Header
+	base    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the original request
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		req.Header.Del(name)
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// httpClient builds the http.Client used by the providers from the config
+func (cfg Config) httpClient() *http.Client {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	if len(cfg.Headers) == 0 {
+		return client
+	}
+
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	withHeaders := *client
+	withHeaders.Transport = &headerTransport{headers: cfg.Headers, base: base}
+
+	return &withHeaders
+}
+
+type responseHeaderKey struct{}
+
+// withResponseHeader returns a context in which recordingTransport stores the
+// headers of the response in header. It is used to read the rate limit headers
+// that the go-openai client doesn't return.
+func withResponseHeader(ctx context.Context, header *http.Header) context.Context {
+	return context.WithValue(ctx, responseHeaderKey{}, header)
+}
+
+// recordingTransport stores the headers of the responses in the header set
+// with withResponseHeader in the request context
+type recordingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if header, ok := req.Context().Value(responseHeaderKey{}).(*http.Header); ok {
+		*header = resp.Header.Clone()
+	}
+
+	return resp, nil
+}
+
+// recordResponseHeaders returns a copy of client whose transport stores the
+// response headers, see withResponseHeader
+func recordResponseHeaders(client *http.Client) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	recording := *client
+	recording.Transport = &recordingTransport{base: base}
+
+	return &recording
+}
@@ -5,8 +5,9 @@ import (
 	"os"
 )
 
-var infoLogger = log.New(os.Stdout, "[INFO] ", log.Ldate|log.Ltime|log.Lshortfile)
-var debugLogger = log.New(os.Stdout, "[DEBUG] ", log.Ldate|log.Ltime|log.Lshortfile)
+// every log goes to stderr, stdout only carries the results of the commands
+var infoLogger = log.New(os.Stderr, "[INFO] ", log.Ldate|log.Ltime|log.Lshortfile)
+var debugLogger = log.New(os.Stderr, "[DEBUG] ", log.Ldate|log.Ltime|log.Lshortfile)
 var errorLogger = log.New(os.Stderr, "[ERROR] ", log.Ldate|log.Ltime|log.Lshortfile)
 
 var isDebugMode bool = os.Getenv("DEBUG") == "1" || os.Getenv("DEBUG") == "true"
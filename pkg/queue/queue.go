@@ -0,0 +1,356 @@
+package queue
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/grafana/auto-triage/pkg/retry"
+)
+
+// Status of a job, which is also the directory it is stored in
+type Status string
+
+const (
+	// StatusPending jobs wait for their next attempt
+	StatusPending Status = "pending"
+	// StatusRunning jobs are being processed
+	StatusRunning Status = "running"
+	// StatusDone jobs succeeded. They are kept to ignore repeated deliveries.
+	StatusDone Status = "done"
+	// StatusDead jobs failed Policy.Attempts times and are only retried by hand
+	StatusDead Status = "dead"
+)
+
+var Statuses = []Status{StatusPending, StatusRunning, StatusDone, StatusDead}
+
+var ErrNotFound = errors.New("job not found")
+
+// safeID matches the IDs that are used as file names as they are
+var safeID = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,100}$`)
+
+// Job is an issue to triage
+type Job struct {
+	ID       string `json:"id"`
+	Repo     string `json:"repo"`
+	IssueID  int    `json:"issueId"`
+	Attempts int    `json:"attempts"`
+	// NextAttempt is when a pending job can run again
+	NextAttempt time.Time `json:"nextAttempt"`
+	LastError   string    `json:"lastError,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	// Status is the directory the job was read from
+	Status Status `json:"-"`
+}
+
+// Queue is a durable job queue stored as one JSON file per job in a directory
+// for each status. Moving a job between statuses is an atomic rename, so the
+// queue survives restarts and can be inspected and changed by other processes
+// while it is in use.
+type Queue struct {
+	dir string
+	// Policy sets the number of attempts before a job is dead and the
+	// backoff between them
+	Policy retry.Policy
+
+	mu sync.Mutex
+}
+
+// Open opens the queue in dir, creating it when needed
+func Open(dir string) (*Queue, error) {
+	for _, status := range Statuses {
+		if err := os.MkdirAll(filepath.Join(dir, string(status)), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Queue{
+		dir:    dir,
+		Policy: retry.Policy{Attempts: 5, BaseDelay: 30 * time.Second, MaxDelay: time.Hour},
+	}, nil
+}
+
+func (q *Queue) path(status Status, id string) string {
+	return filepath.Join(q.dir, string(status), fileName(id))
+}
+
+// fileName is the id, or its hash when it is not safe as a file name
+func fileName(id string) string {
+	if safeID.MatchString(id) {
+		return id + ".json"
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:]) + ".json"
+}
+
+// Enqueue adds a pending job. It returns false, without adding it, when a
+// job with the same ID is already in the queue in any status.
+func (q *Queue) Enqueue(job Job) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, err := q.get(job.ID); err == nil {
+		return false, nil
+	} else if !errors.Is(err, ErrNotFound) {
+		return false, err
+	}
+
+	now := time.Now()
+	job.Attempts = 0
+	job.NextAttempt = now
+	job.CreatedAt = now
+	job.UpdatedAt = now
+
+	return true, q.write(StatusPending, job)
+}
+
+// Claim moves the pending job that has been due for the longest to running
+// and returns it. It returns false when no job is due.
+func (q *Queue) Claim(now time.Time) (Job, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs, err := q.List(StatusPending)
+	if err != nil {
+		return Job{}, false, err
+	}
+
+	slices.SortFunc(jobs, func(a, b Job) int {
+		return a.NextAttempt.Compare(b.NextAttempt)
+	})
+
+	for _, job := range jobs {
+		if job.NextAttempt.After(now) {
+			break
+		}
+
+		err := os.Rename(q.path(StatusPending, job.ID), q.path(StatusRunning, job.ID))
+		if errors.Is(err, os.ErrNotExist) {
+			// retried or purged by another process meanwhile
+			continue
+		}
+		if err != nil {
+			return Job{}, false, err
+		}
+
+		job.Status = StatusRunning
+		return job, true, nil
+	}
+
+	return Job{}, false, nil
+}
+
+// Complete marks the running job as done
+func (q *Queue) Complete(job Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job.LastError = ""
+	return q.move(job, StatusRunning, StatusDone)
+}
+
+// Fail records the error of the running job. The job is pending again after
+// the backoff of Policy, or dead once it failed Policy.Attempts times or when
+// retry is false.
+func (q *Queue) Fail(job Job, cause error, retry bool) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job.Attempts++
+	job.LastError = cause.Error()
+
+	to := StatusPending
+	if !retry || job.Attempts >= q.Policy.Attempts {
+		to = StatusDead
+	} else {
+		job.NextAttempt = time.Now().Add(q.Policy.Backoff(job.Attempts))
+	}
+
+	err := q.move(job, StatusRunning, to)
+	job.Status = to
+	return job, err
+}
+
+// Recover moves the jobs left running, by a process that stopped before
+// finishing them, back to pending. Only call it when no other process is
+// processing the queue.
+func (q *Queue) Recover() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs, err := q.List(StatusRunning)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, job := range jobs {
+		if err := q.move(job, StatusRunning, StatusPending); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(jobs), nil
+}
+
+// Retry makes a dead (or done) job pending again, with its attempts reset
+func (q *Queue) Retry(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.get(id)
+	if err != nil {
+		return err
+	}
+	if job.Status == StatusRunning {
+		return fmt.Errorf("job %s is running", id)
+	}
+
+	job.Attempts = 0
+	job.NextAttempt = time.Now()
+	return q.move(job, job.Status, StatusPending)
+}
+
+// Get returns the job with the ID in any status
+func (q *Queue) Get(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.get(id)
+}
+
+func (q *Queue) get(id string) (Job, error) {
+	for _, status := range Statuses {
+		job, err := q.read(status, fileName(id))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		return job, err
+	}
+	return Job{}, ErrNotFound
+}
+
+// List returns the jobs with the status, oldest first
+func (q *Queue) List(status Status) ([]Job, error) {
+	entries, err := os.ReadDir(filepath.Join(q.dir, string(status)))
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []Job{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		job, err := q.read(status, entry.Name())
+		if errors.Is(err, os.ErrNotExist) {
+			// moved meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	slices.SortFunc(jobs, func(a, b Job) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return jobs, nil
+}
+
+// Purge deletes the jobs with the status last updated before the time
+func (q *Queue) Purge(status Status, before time.Time) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs, err := q.List(status)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, job := range jobs {
+		if !job.UpdatedAt.Before(before) {
+			continue
+		}
+		err := os.Remove(q.path(status, job.ID))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+func (q *Queue) read(status Status, name string) (Job, error) {
+	data, err := os.ReadFile(filepath.Join(q.dir, string(status), name))
+	if err != nil {
+		return Job{}, err
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return Job{}, fmt.Errorf("error reading job %s: %w", name, err)
+	}
+	job.Status = status
+
+	return job, nil
+}
+
+// write stores the job atomically, so a crash never leaves a partial file
+func (q *Queue) write(status Status, job Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(q.dir, ".job-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), q.path(status, job.ID))
+}
+
+// move updates the job and moves it from one status to another
+func (q *Queue) move(job Job, from Status, to Status) error {
+	job.UpdatedAt = time.Now()
+	if err := q.write(to, job); err != nil {
+		return err
+	}
+
+	if from == to {
+		return nil
+	}
+
+	err := os.Remove(q.path(from, job.ID))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
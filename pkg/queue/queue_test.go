@@ -0,0 +1,142 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/auto-triage/pkg/retry"
+)
+
+func openQueue(t *testing.T) *Queue {
+	t.Helper()
+
+	q, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Policy = retry.Policy{Attempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour}
+	return q
+}
+
+func TestEnqueueIgnoresDuplicates(t *testing.T) {
+	q := openQueue(t)
+
+	for i, want := range []bool{true, false} {
+		added, err := q.Enqueue(Job{ID: "delivery-1", Repo: "grafana/grafana", IssueID: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != want {
+			t.Errorf("Enqueue() #%d = %v, want %v", i+1, added, want)
+		}
+	}
+}
+
+func TestClaim(t *testing.T) {
+	q := openQueue(t)
+
+	for _, id := range []string{"first", "second"} {
+		if _, err := q.Enqueue(Job{ID: id, Repo: "grafana/grafana"}); err != nil {
+			t.Fatal(err)
+		}
+		// so the jobs are due one after the other
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, ok, err := q.Claim(time.Now().Add(-time.Hour)); err != nil || ok {
+		t.Fatalf("Claim() before the jobs are due = %v, %v, want no job", ok, err)
+	}
+
+	now := time.Now()
+	for _, want := range []string{"first", "second"} {
+		job, ok, err := q.Claim(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || job.ID != want || job.Status != StatusRunning {
+			t.Fatalf("Claim() = %+v, %v, want running job %s", job, ok, want)
+		}
+	}
+
+	if _, ok, err := q.Claim(now); err != nil || ok {
+		t.Errorf("Claim() of an empty queue = %v, %v, want no job", ok, err)
+	}
+
+	running, err := q.List(StatusRunning)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(running) != 2 {
+		t.Errorf("got %d running jobs, want 2", len(running))
+	}
+}
+
+func TestFail(t *testing.T) {
+	q := openQueue(t)
+	cause := errors.New("model overloaded")
+
+	if _, err := q.Enqueue(Job{ID: "job", Repo: "grafana/grafana"}); err != nil {
+		t.Fatal(err)
+	}
+
+	job, _, err := q.Claim(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	job, err = q.Fail(job, cause, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != StatusPending || job.Attempts != 1 || job.LastError != cause.Error() {
+		t.Fatalf("Fail() = %+v, want a pending job with 1 attempt", job)
+	}
+	// the first backoff is between half and all of BaseDelay
+	if wait := job.NextAttempt.Sub(before); wait < 30*time.Second || wait > time.Minute+time.Second {
+		t.Errorf("next attempt in %s, want between 30s and 1m", wait)
+	}
+
+	if _, ok, _ := q.Claim(time.Now()); ok {
+		t.Fatal("Claim() returned the job before its next attempt")
+	}
+
+	job, ok, err := q.Claim(job.NextAttempt)
+	if err != nil || !ok {
+		t.Fatalf("Claim() at the next attempt = %v, %v, want the job", ok, err)
+	}
+
+	job, err = q.Fail(job, cause, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != StatusDead || job.Attempts != 2 {
+		t.Errorf("Fail() after Policy.Attempts = %+v, want a dead job", job)
+	}
+
+	if stored, err := q.Get("job"); err != nil || stored.Status != StatusDead {
+		t.Errorf("Get() = %+v, %v, want the dead job", stored, err)
+	}
+}
+
+func TestFailNotRetryable(t *testing.T) {
+	q := openQueue(t)
+
+	if _, err := q.Enqueue(Job{ID: "job", Repo: "grafana/grafana"}); err != nil {
+		t.Fatal(err)
+	}
+
+	job, _, err := q.Claim(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err = q.Fail(job, errors.New("issue not found"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != StatusDead || job.Attempts != 1 {
+		t.Errorf("Fail() = %+v, want a dead job after 1 attempt", job)
+	}
+}
@@ -0,0 +1,28 @@
+package retry
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Policy is the number of attempts of an operation and the backoff between
+// them. The wait doubles from BaseDelay up to MaxDelay, with jitter so
+// concurrent operations don't retry at once.
+type Policy struct {
+	// Attempts is the number of attempts, the first one included
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Backoff returns the wait after the failed attempt, doubling from BaseDelay
+// up to MaxDelay, with jitter
+func (p Policy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxDelay)
+
+	return delay/2 + rand.N(delay/2+1)
+}
@@ -0,0 +1,29 @@
+package retry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := Policy{Attempts: 5, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{2, time.Second, 2 * time.Second},
+		{3, 2 * time.Second, 4 * time.Second},
+		{10, 5 * time.Second, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		// the jitter is random, check the bounds a few times
+		for range 20 {
+			if delay := policy.Backoff(tt.attempt); delay < tt.min || delay > tt.max {
+				t.Fatalf("Backoff(%d) = %s, want between %s and %s", tt.attempt, delay, tt.min, tt.max)
+			}
+		}
+	}
+}
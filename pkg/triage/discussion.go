@@ -0,0 +1,136 @@
+package triage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/auto-triage/pkg/github"
+)
+
+// maxCommentTokens caps a single comment in the digest so one long comment
+// (usually pasted logs) doesn't use the whole budget
+const maxCommentTokens = 300
+
+// discussionDigest fetches the comments and timeline of the issue and renders
+// them in at most budget tokens. Timeline events are short and go first,
+// comments follow oldest first until the budget is used.
+func (c *Categorizer) discussionDigest(ctx context.Context, tokens *tokenCounter, issueData *github.Issue) (string, error) {
+	repo := issueData.Repo()
+
+	events, err := c.Github.ListIssueTimeline(ctx, repo, issueData.Number)
+	if err != nil {
+		return "", fmt.Errorf("error fetching timeline: %w", err)
+	}
+
+	comments, err := c.Github.ListIssueComments(ctx, repo, issueData.Number)
+	if err != nil {
+		return "", fmt.Errorf("error fetching comments: %w", err)
+	}
+
+	login, err := c.Github.Login(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error fetching the triager login: %w", err)
+	}
+
+	var b strings.Builder
+	left := c.DiscussionTokens
+
+	// add appends entry if it fits in the budget
+	add := func(entry string) (bool, error) {
+		entryTokens, err := tokens.count(entry)
+		if err != nil {
+			return false, err
+		}
+		if entryTokens > left {
+			return false, nil
+		}
+		left -= entryTokens
+		b.WriteString(entry)
+		return true, nil
+	}
+
+	for _, event := range events {
+		if c.isOwnLabelEvent(event, login) {
+			continue
+		}
+
+		line := timelineLine(event)
+		if line == "" {
+			continue
+		}
+		ok, err := add(line)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			break
+		}
+	}
+
+	for i, comment := range comments {
+		// bot comments and the triager's own explanation, also when posted
+		// with a user token, add no information about the issue
+		if comment.User.Type == "Bot" || (c.CommentMarker != "" && strings.HasPrefix(comment.Body, c.CommentMarker)) {
+			continue
+		}
+
+		body, err := tokens.truncate(comment.Body, maxCommentTokens)
+		if err != nil {
+			return "", err
+		}
+
+		ok, err := add(fmt.Sprintf(
+			"\nComment by @%s on %s:\n%s\n",
+			comment.User.Login,
+			comment.CreatedAt.Format("2006-01-02"),
+			body,
+		))
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			fmt.Fprintf(&b, "\n(%d more comments omitted)\n", len(comments)-i)
+			break
+		}
+	}
+
+	return b.String(), nil
+}
+
+// isOwnLabelEvent reports whether the event adds or removes a label the
+// triager applies, or is sent by the triager's login
+func (c *Categorizer) isOwnLabelEvent(event github.TimelineEvent, login string) bool {
+	if event.Event != "labeled" && event.Event != "unlabeled" {
+		return false
+	}
+	if event.Actor != nil && strings.EqualFold(event.Actor.Login, login) {
+		return true
+	}
+	return event.Label != nil && c.ManagedLabel != nil && c.ManagedLabel(event.Label.Name)
+}
+
+// timelineLine renders the events relevant to triage as one line. Other events
+// return an empty string.
+func timelineLine(event github.TimelineEvent) string {
+	date := event.CreatedAt.Format("2006-01-02")
+
+	switch event.Event {
+	case "labeled", "unlabeled":
+		if event.Label != nil {
+			return fmt.Sprintf("- %s: %s %s\n", date, event.Event, event.Label.Name)
+		}
+	case "renamed":
+		if event.Rename != nil {
+			return fmt.Sprintf("- %s: renamed from %q to %q\n", date, event.Rename.From, event.Rename.To)
+		}
+	case "cross-referenced":
+		if event.Source != nil && event.Source.Issue != nil {
+			return fmt.Sprintf("- %s: referenced by %q\n", date, event.Source.Issue.Title)
+		}
+	case "closed", "reopened":
+		return fmt.Sprintf("- %s: %s\n", date, event.Event)
+	}
+
+	return ""
+}
@@ -0,0 +1,34 @@
+package triage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grafana/auto-triage/pkg/github"
+)
+
+func TestIsOwnLabelEvent(t *testing.T) {
+	c := &Categorizer{ManagedLabel: func(label string) bool {
+		return strings.HasPrefix(label, "area/") || label == "automated-triage"
+	}}
+
+	tests := []struct {
+		name  string
+		event github.TimelineEvent
+		want  bool
+	}{
+		{"managed label", github.TimelineEvent{Event: "labeled", Actor: &github.User{Login: "octocat"}, Label: &github.Label{Name: "area/alerting"}}, true},
+		{"managed label removed", github.TimelineEvent{Event: "unlabeled", Label: &github.Label{Name: "automated-triage"}}, true},
+		{"triager login", github.TimelineEvent{Event: "labeled", Actor: &github.User{Login: "Triage-Bot"}, Label: &github.Label{Name: "priority/high"}}, true},
+		{"label of a person", github.TimelineEvent{Event: "labeled", Actor: &github.User{Login: "octocat"}, Label: &github.Label{Name: "needs-investigation"}}, false},
+		{"rename of the triager", github.TimelineEvent{Event: "renamed", Actor: &github.User{Login: "triage-bot"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.isOwnLabelEvent(tt.event, "triage-bot"); got != tt.want {
+				t.Errorf("isOwnLabelEvent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package triage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Label is an entry of a label catalog. Only Name is required; the rest helps
+// the model tell similar labels apart.
+type Label struct {
+	Name        string   `yaml:"name" json:"name"`
+	Description string   `yaml:"description,omitempty" json:"description,omitempty"`
+	Synonyms    []string `yaml:"synonyms,omitempty" json:"synonyms,omitempty"`
+	// Examples are numbers of issues that have the label
+	Examples []int `yaml:"examples,omitempty" json:"examples,omitempty"`
+	// DoNotUseWhen describes issues that look like they have the label but
+	// should not get it
+	DoNotUseWhen string `yaml:"doNotUseWhen,omitempty" json:"doNotUseWhen,omitempty"`
+}
+
+// Catalog is the list of labels the model can choose from
+type Catalog []Label
+
+// Names returns the names of the labels in the catalog
+func (c Catalog) Names() []string {
+	names := make([]string, 0, len(c))
+	for _, label := range c {
+		names = append(names, label.Name)
+	}
+	return names
+}
+
+// Contains reports whether the catalog has a label with the name
+func (c Catalog) Contains(name string) bool {
+	for _, label := range c {
+		if label.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Render lists the labels for the prompt, one per line. Labels without
+// details are rendered as just their name.
+func (c Catalog) Render() string {
+	lines := make([]string, 0, len(c))
+	for _, label := range c {
+		lines = append(lines, label.render())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (l Label) render() string {
+	details := []string{}
+	if l.Description != "" {
+		details = append(details, strings.TrimSuffix(l.Description, "."))
+	}
+	if len(l.Synonyms) > 0 {
+		details = append(details, "Also known as: "+strings.Join(l.Synonyms, ", "))
+	}
+	if len(l.Examples) > 0 {
+		examples := make([]string, 0, len(l.Examples))
+		for _, number := range l.Examples {
+			examples = append(examples, fmt.Sprintf("#%d", number))
+		}
+		details = append(details, "Example issues: "+strings.Join(examples, ", "))
+	}
+	if l.DoNotUseWhen != "" {
+		details = append(details, "Do not use when: "+strings.TrimSuffix(l.DoNotUseWhen, "."))
+	}
+
+	if len(details) == 0 {
+		return l.Name
+	}
+	return l.Name + ": " + strings.Join(details, ". ") + "."
+}
+
+// ReadCatalog reads a label catalog. Files with a .yaml, .yml or .json
+// extension hold a list of labels with their details, any other file is read
+// as one label name per line.
+func ReadCatalog(file string) (Catalog, error) {
+	var catalog Catalog
+
+	switch filepath.Ext(file) {
+	case ".yaml", ".yml", ".json":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		if filepath.Ext(file) == ".json" {
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			decoder.DisallowUnknownFields()
+			err = decoder.Decode(&catalog)
+		} else {
+			decoder := yaml.NewDecoder(bytes.NewReader(data))
+			decoder.KnownFields(true)
+			err = decoder.Decode(&catalog)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing label catalog %s: %w", file, err)
+		}
+
+		seen := map[string]bool{}
+		for i, label := range catalog {
+			if label.Name == "" {
+				return nil, fmt.Errorf("label catalog %s: entry %d has no name", file, i)
+			}
+			if seen[label.Name] {
+				return nil, fmt.Errorf("label catalog %s: %s is listed more than once", file, label.Name)
+			}
+			seen[label.Name] = true
+		}
+	default:
+		lines, err := ReadLines(file)
+		if err != nil {
+			return nil, err
+		}
+
+		seen := map[string]bool{}
+		for _, line := range lines {
+			name := strings.TrimSpace(line)
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			catalog = append(catalog, Label{Name: name})
+		}
+	}
+
+	return catalog, nil
+}
+
+// WriteCatalog writes the catalog in the format ReadCatalog reads for the file
+// extension. Plain text files only keep the label names.
+func WriteCatalog(file string, catalog Catalog) error {
+	var data []byte
+	var err error
+
+	switch filepath.Ext(file) {
+	case ".json":
+		data, err = json.MarshalIndent(catalog, "", "  ")
+		data = append(data, '\n')
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(catalog)
+	default:
+		data = []byte(strings.Join(catalog.Names(), "\n") + "\n")
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, data, 0o644)
+}
+
+// DiffLabels returns the labels to add to and remove from an issue with the
+// current labels so its managed labels are exactly the predicted ones. Labels
+// that are not managed are never removed. Names are compared ignoring case.
+func DiffLabels(current []string, predicted []string, managed func(string) bool) (add []string, remove []string) {
+	contains := func(labels []string, label string) bool {
+		return slices.ContainsFunc(labels, func(l string) bool {
+			return strings.EqualFold(l, label)
+		})
+	}
+
+	add = []string{}
+	for _, label := range predicted {
+		if !contains(current, label) && !contains(add, label) {
+			add = append(add, label)
+		}
+	}
+
+	remove = []string{}
+	for _, label := range current {
+		if managed(label) && !contains(predicted, label) {
+			remove = append(remove, label)
+		}
+	}
+
+	return add, remove
+}
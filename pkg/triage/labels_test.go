@@ -0,0 +1,59 @@
+package triage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLabels(t *testing.T) {
+	managed := func(label string) bool {
+		return strings.HasPrefix(label, "area/") || strings.HasPrefix(label, "type/")
+	}
+
+	tests := []struct {
+		name       string
+		current    []string
+		predicted  []string
+		wantAdd    []string
+		wantRemove []string
+	}{
+		{
+			name:       "new issue",
+			current:    []string{},
+			predicted:  []string{"area/alerting", "type/bug"},
+			wantAdd:    []string{"area/alerting", "type/bug"},
+			wantRemove: []string{},
+		},
+		{
+			name:       "already labeled",
+			current:    []string{"area/alerting", "type/bug"},
+			predicted:  []string{"area/alerting", "type/bug"},
+			wantAdd:    []string{},
+			wantRemove: []string{},
+		},
+		{
+			name:       "changed prediction",
+			current:    []string{"area/explore", "type/bug", "priority/high"},
+			predicted:  []string{"area/alerting", "type/bug"},
+			wantAdd:    []string{"area/alerting"},
+			wantRemove: []string{"area/explore"},
+		},
+		{
+			name:       "case and duplicates",
+			current:    []string{"Area/Alerting"},
+			predicted:  []string{"area/alerting", "type/bug", "TYPE/bug"},
+			wantAdd:    []string{"type/bug"},
+			wantRemove: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			add, remove := DiffLabels(tt.current, tt.predicted, managed)
+			if !reflect.DeepEqual(add, tt.wantAdd) || !reflect.DeepEqual(remove, tt.wantRemove) {
+				t.Errorf("DiffLabels() = %v, %v, want %v, %v", add, remove, tt.wantAdd, tt.wantRemove)
+			}
+		})
+	}
+}
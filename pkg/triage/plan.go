@@ -0,0 +1,68 @@
+package triage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProjectAssignment adds the issue to a GitHub project (v2) of an
+// organization
+type ProjectAssignment struct {
+	Org    string `json:"org"`
+	Number int    `json:"number"`
+}
+
+func (p ProjectAssignment) String() string {
+	return fmt.Sprintf("%s/%d", p.Org, p.Number)
+}
+
+// Plan lists the changes the triage makes to an issue. It is computed before
+// touching the issue so it can be reviewed in a dry run, and applying it makes
+// exactly these changes.
+type Plan struct {
+	Repo        string `json:"repo"`
+	IssueID     int    `json:"issueId"`
+	IssueNodeID string `json:"issueNodeId,omitempty"`
+	// AddLabels are the labels the issue doesn't have yet
+	AddLabels []string `json:"addLabels"`
+	// RemoveLabels are the stale managed labels, only set on re-triage
+	RemoveLabels []string `json:"removeLabels"`
+	// Comment is the body of the triage comment, created or updated in place.
+	// No comment is posted when empty.
+	Comment  string              `json:"comment,omitempty"`
+	Projects []ProjectAssignment `json:"projects,omitempty"`
+}
+
+// IsEmpty reports whether the plan doesn't change the issue
+func (p Plan) IsEmpty() bool {
+	return len(p.AddLabels) == 0 && len(p.RemoveLabels) == 0 && p.Comment == "" && len(p.Projects) == 0
+}
+
+// String renders the plan as a diff for people to review
+func (p Plan) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s#%d\n", p.Repo, p.IssueID)
+	if p.IsEmpty() {
+		b.WriteString("  no changes\n")
+		return b.String()
+	}
+
+	for _, label := range p.AddLabels {
+		fmt.Fprintf(&b, "  + label   %s\n", label)
+	}
+	for _, label := range p.RemoveLabels {
+		fmt.Fprintf(&b, "  - label   %s\n", label)
+	}
+	for _, project := range p.Projects {
+		fmt.Fprintf(&b, "  + project %s\n", project)
+	}
+	if p.Comment != "" {
+		b.WriteString("  ~ comment\n")
+		for _, line := range strings.Split(p.Comment, "\n") {
+			fmt.Fprintf(&b, "    | %s\n", line)
+		}
+	}
+
+	return b.String()
+}
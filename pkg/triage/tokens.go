@@ -0,0 +1,85 @@
+package triage
+
+import (
+	"strings"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// DefaultEncoding is used for models missing from ModelEncodings, such as
+// non OpenAI models, where the count is only an approximation
+const DefaultEncoding = tokenizer.Cl100kBase
+
+// ModelEncodings maps model name prefixes to the encoding of their tokenizer.
+// The longest matching prefix wins, so "gpt-4o" takes precedence over
+// "gpt-4".
+var ModelEncodings = map[string]tokenizer.Encoding{
+	"gpt-5":          tokenizer.O200kBase,
+	"gpt-4.1":        tokenizer.O200kBase,
+	"gpt-4o":         tokenizer.O200kBase,
+	"chatgpt-4o":     tokenizer.O200kBase,
+	"o1":             tokenizer.O200kBase,
+	"o3":             tokenizer.O200kBase,
+	"o4":             tokenizer.O200kBase,
+	"gpt-4":          tokenizer.Cl100kBase,
+	"gpt-3.5":        tokenizer.Cl100kBase,
+	"gpt-35":         tokenizer.Cl100kBase,
+	"ft:gpt-4.1":     tokenizer.O200kBase,
+	"ft:gpt-4o":      tokenizer.O200kBase,
+	"ft:gpt-4":       tokenizer.Cl100kBase,
+	"ft:gpt-3.5":     tokenizer.Cl100kBase,
+	"text-embedding": tokenizer.Cl100kBase,
+}
+
+// EncodingForModel returns the encoding of the tokenizer of model
+func EncodingForModel(model string) tokenizer.Encoding {
+	encoding := DefaultEncoding
+	longest := 0
+
+	for prefix, enc := range ModelEncodings {
+		if strings.HasPrefix(model, prefix) && len(prefix) > longest {
+			encoding = enc
+			longest = len(prefix)
+		}
+	}
+
+	return encoding
+}
+
+// tokenCounter counts and cuts text in tokens of one encoding
+type tokenCounter struct {
+	codec tokenizer.Codec
+}
+
+func newTokenCounter(encoding tokenizer.Encoding) (*tokenCounter, error) {
+	codec, err := tokenizer.Get(encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenCounter{codec: codec}, nil
+}
+
+// count returns the number of tokens of text
+func (t *tokenCounter) count(text string) (int, error) {
+	ids, _, err := t.codec.Encode(text)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
+
+// truncate cuts text to at most max tokens
+func (t *tokenCounter) truncate(text string, max int) (string, error) {
+	ids, _, err := t.codec.Encode(text)
+	if err != nil {
+		return "", err
+	}
+
+	if len(ids) <= max {
+		return text, nil
+	}
+
+	return t.codec.Decode(ids[:max])
+}
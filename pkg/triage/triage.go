@@ -0,0 +1,389 @@
+package triage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/grafana/auto-triage/pkg/github"
+	"github.com/grafana/auto-triage/pkg/llm"
+	"github.com/grafana/auto-triage/pkg/logme"
+	"github.com/mrz1836/go-sanitize"
+	"github.com/sashabaranov/go-openai/jsonschema"
+	"github.com/tiktoken-go/tokenizer"
+)
+
+type QualityVeredict struct {
+	IsCategorizable bool        `json:"isCategorizable"`
+	ID              interface{} `json:"id"`
+	Remarks         string      `json:"remarks"`
+}
+
+type CategorizedIssue struct {
+	ID              interface{} `json:"id"`
+	CategoryLabel   []string    `json:"categoryLabel"`
+	TypeLabel       []string    `json:"typeLabel"`
+	IsCategorizable bool        `json:"isCategorizable"`
+	Remarks         string      `json:"remarks"`
+	// Confidence is the confidence of the model, between 0 and 1, for every
+	// label it predicted
+	Confidence map[string]float64 `json:"confidence,omitempty"`
+	// LowConfidenceLabels were predicted with a confidence below the
+	// threshold and are not in CategoryLabel or TypeLabel
+	LowConfidenceLabels []string `json:"lowConfidenceLabels,omitempty"`
+	// NeedsReview is set when some labels were dropped for low confidence or
+	// no category is left
+	NeedsReview bool `json:"needsReview"`
+	// InputTokens is the number of tokens of the prompt sent to the model
+	InputTokens int `json:"inputTokens"`
+	// Truncated is set when the issue body was shortened to fit
+	// MaxInputTokens
+	Truncated bool `json:"truncated,omitempty"`
+	// Usage sums the tokens and cost of every request, retries included
+	Usage Usage `json:"usage"`
+	// UnknownLabels were not applied because they don't exist in the repo
+	UnknownLabels []string `json:"unknownLabels,omitempty"`
+	// Plan holds the changes made to the issue, or that would be made in a
+	// dry run
+	Plan *Plan `json:"plan,omitempty"`
+}
+
+// LabelPrediction is a label predicted by the model with its confidence
+type LabelPrediction struct {
+	Label      string  `json:"label"`
+	Confidence float64 `json:"confidence"`
+}
+
+// modelResult is the structured output schema the model answers with
+type modelResult struct {
+	ID              int               `json:"id"`
+	IsCategorizable bool              `json:"isCategorizable"`
+	Remarks         string            `json:"remarks"`
+	CategoryLabels  []LabelPrediction `json:"categoryLabels"`
+	TypeLabels      []LabelPrediction `json:"typeLabels"`
+}
+
+// Categorizer asks the model for the category and type labels of an issue
+type Categorizer struct {
+	Provider llm.Provider
+	Model    string
+	// Prompt is the system prompt
+	Prompt         string
+	CategoryLabels Catalog
+	TypeLabels     Catalog
+	// Retry is the policy for the requests that fail or return an invalid
+	// answer. Its Attempts is the number of attempts to get a valid answer
+	// from the model.
+	Retry llm.RetryPolicy
+	// ConfidenceThreshold is the minimum confidence for a label to be kept
+	ConfidenceThreshold float64
+	// DiscussionTokens is the token budget for the digest of the issue
+	// comments and timeline added to the user message. The discussion is not
+	// fetched when 0.
+	DiscussionTokens int
+	// CommentMarker starts the comments of the triager, which are left out
+	// of the discussion so the model doesn't see its previous answer
+	CommentMarker string
+	// ManagedLabel reports whether the triager applies the label. The events
+	// of these labels, and the label events of the triager's login, are left
+	// out of the discussion for the same reason.
+	ManagedLabel func(label string) bool
+	// Github is used to fetch the discussion
+	Github *github.Client
+	// MaxInputTokens caps the tokens of the prompt (system and user
+	// messages). The issue body is truncated to fit. No limit when 0.
+	MaxInputTokens int
+	// Encoding of the tokenizer used to count tokens. Defaults to the
+	// encoding of Model.
+	Encoding tokenizer.Encoding
+	// Prices used to estimate the cost of the requests. The cost is 0 for
+	// models without a price.
+	Prices llm.Prices
+}
+
+// tokenCounter returns the counter for Encoding, or for the encoding of Model
+// when not set
+func (c *Categorizer) tokenCounter() (*tokenCounter, error) {
+	encoding := c.Encoding
+	if encoding == "" {
+		encoding = EncodingForModel(c.Model)
+	}
+
+	return newTokenCounter(encoding)
+}
+
+// Categorize categorizes the issue, retrying when the model fails or answers
+// with labels that are not in the label lists
+func (c *Categorizer) Categorize(ctx context.Context, issueData *github.Issue) (CategorizedIssue, error) {
+	var err error
+
+	logme.InfoF(":: Categorizing issue\n")
+	logme.DebugF("Repo: %s\n", issueData.Repo())
+	logme.DebugF("Issue ID: %d\n", issueData.Number)
+	logme.DebugF("Model: %s\n", c.Model)
+	logme.DebugF("Issue title: %s\n", issueData.Title)
+
+	tokens, err := c.tokenCounter()
+	if err != nil {
+		return CategorizedIssue{}, err
+	}
+
+	discussion := ""
+	if c.DiscussionTokens > 0 {
+		discussion, err = c.discussionDigest(ctx, tokens, issueData)
+		if err != nil {
+			return CategorizedIssue{}, err
+		}
+		if discussion != "" {
+			discussion = "\n\nIssue discussion:\n" + discussion
+		}
+	}
+
+	userMessage, inputTokens, truncated, err := c.buildUserMessage(tokens, issueData, discussion)
+	if err != nil {
+		return CategorizedIssue{}, err
+	}
+
+	logme.DebugF("Tokens: %d\n", inputTokens)
+	if truncated {
+		logme.InfoF("Issue body truncated to fit %d input tokens\n", c.MaxInputTokens)
+	}
+
+	category := CategorizedIssue{}
+	usage := Usage{}
+
+	err = c.Retry.Do(ctx, func(attempt int) error {
+		var requestUsage llm.Usage
+		var err error
+		category, requestUsage, err = c.getIssueCategory(ctx, userMessage)
+		// requests that failed before reaching the model cost nothing
+		if err == nil || requestUsage != (llm.Usage{}) {
+			usage.Add(c.requestUsage(requestUsage, inputTokens))
+		}
+		if err != nil {
+			return fmt.Errorf("error categorizing issue: %w", err)
+		}
+		if category.ID == 0 || category.ID == nil {
+			return fmt.Errorf("error categorizing issue: model returned no id")
+		}
+		return c.filterLabels(&category)
+	})
+	if err != nil {
+		// the usage is returned so callers can account for the failed requests
+		return CategorizedIssue{Usage: usage}, fmt.Errorf("no valid categorization: %w", err)
+	}
+
+	category.InputTokens = inputTokens
+	category.Truncated = truncated
+	category.Usage = usage
+
+	logme.InfoF("Finished categorizing issue")
+
+	return category, nil
+}
+
+// filterLabels drops the labels that are not in the label lists and applies
+// the confidence threshold. It fails when the model answered only with
+// unknown categories.
+func (c *Categorizer) filterLabels(category *CategorizedIssue) error {
+	// the model found the issue lacks the information to pick labels
+	// (empty body, spam, noise). Nothing to filter, and no labels apply.
+	if !category.IsCategorizable {
+		logme.InfoF("Issue is not categorizable: %s\n", category.Remarks)
+		category.CategoryLabel = []string{}
+		category.TypeLabel = []string{}
+		category.Confidence = nil
+		category.Remarks = sanitize.AlphaNumeric(category.Remarks, true)
+		return nil
+	}
+
+	// filter out the categories that are not in the categoryLabels
+	confidence := category.Confidence
+	realCategories := []string{}
+	for _, category := range category.CategoryLabel {
+		if c.CategoryLabels.Contains(category) {
+			realCategories = append(realCategories, category)
+		} else {
+			logme.DebugF("Category %s is not in categoryLabels. Skipping", category)
+			delete(confidence, category)
+		}
+	}
+
+	if len(realCategories) == 0 {
+		return fmt.Errorf("error categorizing issue: model returned only false categories")
+	}
+
+	category.CategoryLabel = realCategories
+
+	// filter out the labels that are not in the typeLabels
+	realTypes := []string{}
+	for _, typeLabel := range category.TypeLabel {
+		if c.TypeLabels.Contains(typeLabel) {
+			realTypes = append(realTypes, typeLabel)
+		} else {
+			logme.DebugF("Type %s is not in typeLabels. Skipping", typeLabel)
+			delete(confidence, typeLabel)
+		}
+	}
+
+	category.TypeLabel = realTypes
+	category.Remarks = sanitize.AlphaNumeric(category.Remarks, true)
+	c.applyConfidenceThreshold(category)
+
+	return nil
+}
+
+// applyConfidenceThreshold moves the labels below the threshold to
+// LowConfidenceLabels and flags the issue for review when any was dropped
+func (c *Categorizer) applyConfidenceThreshold(category *CategorizedIssue) {
+	keep := func(labels []string) []string {
+		kept := []string{}
+		for _, label := range labels {
+			if category.Confidence[label] < c.ConfidenceThreshold {
+				logme.DebugF("Label %s is below the confidence threshold (%.2f)\n", label, category.Confidence[label])
+				category.LowConfidenceLabels = append(category.LowConfidenceLabels, label)
+				continue
+			}
+			kept = append(kept, label)
+		}
+		return kept
+	}
+
+	category.CategoryLabel = keep(category.CategoryLabel)
+	category.TypeLabel = keep(category.TypeLabel)
+	category.NeedsReview = len(category.LowConfidenceLabels) > 0 || len(category.CategoryLabel) == 0
+}
+
+// ReadLines reads a file with one entry per line, such as the label files
+func ReadLines(s string) ([]string, error) {
+	file, err := os.Open(s)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, nil
+
+}
+
+// buildUserMessage renders the user message for the issue, truncating its body
+// when the prompt would go over MaxInputTokens. It returns the message, the
+// tokens of the whole prompt and whether the body was truncated.
+func (c *Categorizer) buildUserMessage(tokens *tokenCounter, issueData *github.Issue, discussion string) (string, int, bool, error) {
+	render := func(body string) string {
+		return `
+					  Issue ID: ` + strconv.Itoa(issueData.Number) + `
+					  Issue title: ` + issueData.Title + `
+					  Issue description:\n\n ` + body + discussion + `
+
+						According to the following list, which category and type do you think this issue belongs to?
+
+					List of categories:
+					` + c.CategoryLabels.Render() +
+			`
+					List of types: ` + c.TypeLabels.Render()
+	}
+
+	promptTokens, err := tokens.count(c.Prompt)
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	message := render(issueData.Body)
+	messageTokens, err := tokens.count(message)
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	if c.MaxInputTokens == 0 || promptTokens+messageTokens <= c.MaxInputTokens {
+		return message, promptTokens + messageTokens, false, nil
+	}
+
+	// everything but the body is fixed, the body gets what's left
+	fixedTokens, err := tokens.count(render(""))
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	bodyBudget := c.MaxInputTokens - promptTokens - fixedTokens
+	if bodyBudget <= 0 {
+		return "", 0, false, fmt.Errorf(
+			"prompt, labels and discussion use %d tokens, over the %d max input tokens",
+			promptTokens+fixedTokens,
+			c.MaxInputTokens,
+		)
+	}
+
+	body, truncated, err := truncateBody(tokens, issueData.Body, bodyBudget)
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	message = render(body)
+	messageTokens, err = tokens.count(message)
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	return message, promptTokens + messageTokens, truncated, nil
+}
+
+func (c *Categorizer) getIssueCategory(ctx context.Context, userMessage string) (CategorizedIssue, llm.Usage, error) {
+	// set up structured output schema
+	var result modelResult
+	schema, err := jsonschema.GenerateSchemaForType(result)
+	if err != nil {
+		return CategorizedIssue{}, llm.Usage{}, err
+	}
+
+	resp, err := c.Provider.Complete(
+		ctx,
+		llm.Request{
+			Model:      c.Model,
+			System:     c.Prompt,
+			User:       userMessage,
+			SchemaName: "math_reasoning",
+			Schema:     schema,
+		},
+	)
+
+	if err != nil {
+		return CategorizedIssue{}, resp.Usage, err
+	}
+
+	err = json.Unmarshal([]byte(resp.Content), &result)
+	if err != nil {
+		return CategorizedIssue{}, resp.Usage, fmt.Errorf("error unmarshaling issue category: %w", err)
+	}
+
+	category := CategorizedIssue{
+		ID:              result.ID,
+		IsCategorizable: result.IsCategorizable,
+		Remarks:         result.Remarks,
+		CategoryLabel:   []string{},
+		TypeLabel:       []string{},
+		Confidence:      map[string]float64{},
+	}
+
+	for _, prediction := range result.CategoryLabels {
+		category.CategoryLabel = append(category.CategoryLabel, prediction.Label)
+		category.Confidence[prediction.Label] = prediction.Confidence
+	}
+
+	for _, prediction := range result.TypeLabels {
+		category.TypeLabel = append(category.TypeLabel, prediction.Label)
+		category.Confidence[prediction.Label] = prediction.Confidence
+	}
+
+	return category, resp.Usage, nil
+
+}
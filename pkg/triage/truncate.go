@@ -0,0 +1,103 @@
+package triage
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// signalLine matches the lines of pasted logs worth keeping when a body is
+// truncated: errors and stack frames
+var signalLine = regexp.MustCompile(
+	`(?i)(error|exception|panic|fatal|failed|traceback|caused by|goroutine \d+|^\s+at \S+|\.(go|js|ts|tsx|py|java):\d+)`,
+)
+
+// Share of the budget of a truncated body used by the head and the tail. The
+// rest is used by the signal lines of the middle.
+const (
+	headShare = 0.4
+	tailShare = 0.2
+)
+
+// truncateBody shortens body to at most max tokens. It keeps the beginning of
+// the body, where the issue is usually described, the end, and as many error
+// and stack trace lines from the middle as fit. It reports whether the body
+// was truncated.
+func truncateBody(tokens *tokenCounter, body string, max int) (string, bool, error) {
+	bodyTokens, err := tokens.count(body)
+	if err != nil {
+		return "", false, err
+	}
+
+	if bodyTokens <= max {
+		return body, false, nil
+	}
+
+	lines := strings.Split(body, "\n")
+	lineTokens := make([]int, len(lines))
+	for i, line := range lines {
+		lineTokens[i], err = tokens.count(line + "\n")
+		if err != nil {
+			return "", false, err
+		}
+	}
+
+	// head: first lines up to its share
+	head := 0
+	for budget := int(float64(max) * headShare); head < len(lines) && lineTokens[head] <= budget; head++ {
+		budget -= lineTokens[head]
+	}
+
+	// tail: last lines up to its share, without overlapping the head
+	tail := len(lines)
+	for budget := int(float64(max) * tailShare); tail > head && lineTokens[tail-1] <= budget; tail-- {
+		budget -= lineTokens[tail-1]
+	}
+
+	// middle: error lines, once each, with what's left
+	used := 0
+	for i := 0; i < head; i++ {
+		used += lineTokens[i]
+	}
+	for i := tail; i < len(lines); i++ {
+		used += lineTokens[i]
+	}
+
+	budget := max - used
+	seen := map[string]bool{}
+	signals := []string{}
+	for i := head; i < tail; i++ {
+		// the indentation is matched, as in the "  at fn (file:line)" frames,
+		// but not part of the duplicate check
+		line := strings.TrimSpace(lines[i])
+		if line == "" || seen[line] || !signalLine.MatchString(lines[i]) {
+			continue
+		}
+		// leave room for the omission markers
+		if lineTokens[i] > budget-20 {
+			break
+		}
+		seen[line] = true
+		budget -= lineTokens[i]
+		signals = append(signals, lines[i])
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Join(lines[:head], "\n"))
+	if len(signals) > 0 {
+		fmt.Fprintf(&b, "\n[... %d lines omitted, error lines kept below ...]\n", tail-head)
+		b.WriteString(strings.Join(signals, "\n"))
+		b.WriteString("\n[...]\n")
+	} else {
+		fmt.Fprintf(&b, "\n[... %d lines omitted ...]\n", tail-head)
+	}
+	b.WriteString(strings.Join(lines[tail:], "\n"))
+
+	// a single huge line can still go over, cut it hard
+	truncated, err := tokens.truncate(b.String(), max)
+	if err != nil {
+		return "", false, err
+	}
+
+	return truncated, true, nil
+}
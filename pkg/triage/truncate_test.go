@@ -0,0 +1,58 @@
+package triage
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+func TestTruncateBody(t *testing.T) {
+	tokens, err := newTokenCounter(tokenizer.Cl100kBase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	short := "The alert list is empty after the upgrade"
+	got, truncated, err := truncateBody(tokens, short, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if truncated || got != short {
+		t.Errorf("truncateBody() = %q, %v, want the body unchanged", got, truncated)
+	}
+
+	lines := []string{"**What happened**: the alert rules fail after the upgrade", "```"}
+	for i := range 200 {
+		lines = append(lines, fmt.Sprintf("level=info msg=\"evaluating rule\" rule_uid=abc%d", i))
+		if i == 120 {
+			lines = append(lines, "level=error msg=\"rule evaluation failed\" err=\"context deadline exceeded\"")
+		}
+		if i == 140 {
+			// a stack frame is kept by its indentation, it has no error word
+			// nor file extension
+			lines = append(lines, "    at processTicksAndRejections (node:internal/process/task_queues:95:5)")
+		}
+	}
+	lines = append(lines, "```", "Grafana version: 11.3.0")
+	body := strings.Join(lines, "\n")
+
+	max := 200
+	got, truncated, err = truncateBody(tokens, body, max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !truncated {
+		t.Fatal("truncateBody() did not truncate the body")
+	}
+
+	if n, _ := tokens.count(got); n > max {
+		t.Errorf("truncated body has %d tokens, want at most %d", n, max)
+	}
+	for _, want := range []string{"**What happened**", "context deadline exceeded", "    at processTicksAndRejections", "lines omitted, error lines kept below", "Grafana version: 11.3.0"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("truncated body is missing %q:\n%s", want, got)
+		}
+	}
+}
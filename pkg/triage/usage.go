@@ -0,0 +1,36 @@
+package triage
+
+import (
+	"github.com/grafana/auto-triage/pkg/llm"
+)
+
+// Usage is the token usage and estimated cost of one or more requests to the
+// model
+type Usage struct {
+	llm.Usage
+	Requests int     `json:"requests"`
+	CostUSD  float64 `json:"costUSD"`
+}
+
+func (u *Usage) Add(other Usage) {
+	u.Usage.Add(other.Usage)
+	u.Requests += other.Requests
+	u.CostUSD += other.CostUSD
+}
+
+// requestUsage returns the usage of a single request. When the provider
+// doesn't report the prompt tokens, as some local servers do, the local count
+// of inputTokens is used instead.
+func (c *Categorizer) requestUsage(usage llm.Usage, inputTokens int) Usage {
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = inputTokens
+	}
+
+	result := Usage{Usage: usage, Requests: 1}
+
+	if price, ok := c.Prices.ForModel(c.Model); ok {
+		result.CostUSD = price.Cost(usage)
+	}
+
+	return result
+}